@@ -85,18 +85,28 @@ func (conf *Config) CoreAdmin(dat *IOdata) error {
 		dat.output = "Role granted."
 	} else if arg == "channel" {
 		return dat.ChannelCore()
+	} else if arg == "export" || arg == "import" {
+		return conf.CoreBundle(dat)
+	} else if arg == "attachments" {
+		return conf.CoreAttachments(dat)
 	} else if arg == "help" {
 		dat.output = fmt.Sprintf("Admin Help:\n"+
 			"```%s\n\t - %s\n"+
 			"%s\n\t - %s\n"+
 			"%s\n\t - %s\n"+
 			"%s\n\t - %s\n"+
+			"%s\n\t - %s\n"+
+			"%s\n\t - %s\n"+
+			"%s\n\t - %s\n"+
 			"%s\n\t - %s\n```",
 			"admin reset", "Resets to the bot's defaults.",
 			"admin prefix [prefix]", "Sets the bots command prefix to the desired.",
 			"admin nick [new_nick]", "Assigns a new name to the bot.",
 			"admin channel enable/disable", " Enable or disable bot commands in the channel.",
-			"admin grant [role] [id]", "Grants either an Admin or Moderator role to a user.")
+			"admin grant [role] [id]", "Grants either an Admin or Moderator role to a user.",
+			"admin export", "Uploads the guild's configuration as a JSON bundle.",
+			"admin import [confirm/cancel]", "Attach a bundle to preview changes, then confirm to apply.",
+			"admin attachments [on/off/max/quota]", "Stores attachments on the bot, shows the space used.")
 		return nil
 	}
 
@@ -214,7 +224,7 @@ func (conf *Config) GuildConfigLoad() error {
 				fmt.Printf("DEBUG: New Guild while while loading:\n [%s] %s\n", g.ID, g.Name)
 				ng := &discordgo.GuildCreate{Guild: g}
 				conf.guildCreateHandler(conf.Core.Session, ng)
-				return nil
+				continue
 			}
 			return err
 		}
@@ -329,6 +339,10 @@ func (g *GuildConfig) Update() error {
 		"init":   g.Init,
 		"roles":  g.Roles,
 		"prefix": g.Prefix,
+
+		"attachments":     g.Attachments,
+		"attachmentmax":   g.AttachmentMax,
+		"attachmentquota": g.AttachmentQuota,
 	}
 
 	var dbdat = DBdataCreate(g.ID, CollectionConfig, g, q, c)
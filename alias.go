@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	getopt "github.com/pborman/getopt/v2"
@@ -21,21 +23,41 @@ import (
 
 // Unique errors for Aliases.
 var (
-	ErrNoAliases = errors.New("no aliases found")
+	ErrNoAliases       = errors.New("no aliases found")
+	ErrAliasArgMissing = func(caller, name string) error {
+		return fmt.Errorf("alias **%s** requires argument `$%s`", caller, name)
+	}
+	ErrAliasBadPlaceholder = func(caller, name string) error {
+		return fmt.Errorf("alias **%s** has an unknown placeholder `$%s`", caller, name)
+	}
+	ErrAliasCycle = func(chain []string) error {
+		return fmt.Errorf("alias loop detected: %s", strings.Join(chain, " -> "))
+	}
+	ErrAliasDepth = fmt.Errorf("aliases can only be chained %d deep", aliasDepthMax)
+)
+
+// Alias scope and resolution limits.
+const (
+	AliasGlobal   = "config" // Database holding the bot-wide aliases.
+	aliasDepthMax = 5        // Maximum aliases followed for a single command.
 )
 
 // Syntax constants for Alias Commands.
 const (
 	aliasSyntaxAdd    = ",alias   --add      -i ub   -o \"user -ban\"\n"
+	aliasSyntaxArgs   = ",alias   --add      -i give -o \"user --xfer --user $1 -n ${2:100}\"\n"
 	aliasSyntaxRemove = ",alias   --remove   -i ub\n"
 	aliasSyntaxList   = ",alias   --list\n"
-	aliasSyntaxAll    = "\n\n" + aliasSyntaxAdd + aliasSyntaxRemove + aliasSyntaxList
+	aliasSyntaxToggle = ",alias   --disable  -i gamble\n,alias   --enable   -i gamble\n"
+	aliasSyntaxVars   = "\nPlaceholders:\n  $1 $2 ...   Arguments (required)\n  ${1:text}   Argument with a default\n" +
+		"  $@          All arguments\n  $user       Caller\n  $channel    Current channel\n"
+	aliasSyntaxAll = "\n\n" + aliasSyntaxAdd + aliasSyntaxArgs + aliasSyntaxRemove + aliasSyntaxList + aliasSyntaxToggle + aliasSyntaxVars
 )
 
 // CoreAlias processes creating and destroying new aliases.
 func (dat *IOdata) CoreAlias() error {
 	u := dat.user
-	var help, list, add, remove bool
+	var help, list, add, remove, disable, enable bool
 	var caller, linked string
 
 	fl := getopt.New()
@@ -44,6 +66,8 @@ func (dat *IOdata) CoreAlias() error {
 	fl.FlagLong(&list, "list", 'l', "List all Aliases")
 	fl.FlagLong(&add, "add", 'a', "Add")
 	fl.FlagLong(&remove, "remove", 'r', "Remove")
+	fl.FlagLong(&disable, "disable", 0, "Disable a global alias for this guild")
+	fl.FlagLong(&enable, "enable", 0, "Re-enable a disabled global alias")
 	fl.Flag(&caller, 'i', "Input (Alias) text")
 	fl.Flag(&linked, 'o', "Original (What it is referring to)")
 
@@ -62,7 +86,7 @@ func (dat *IOdata) CoreAlias() error {
 	}
 
 	// Empty help to skip to end of script to print.
-	if add || remove {
+	if add || remove || disable || enable {
 		if caller == "" {
 			return errors.New("bad alias name")
 		}
@@ -71,6 +95,12 @@ func (dat *IOdata) CoreAlias() error {
 			if linked == "" {
 				return errors.New("bad original command")
 			}
+			if err := alias.Validate(); err != nil {
+				return err
+			}
+			if err := alias.Chain(); err != nil {
+				return err
+			}
 			if err := alias.Update(); err != nil {
 				return err
 			}
@@ -85,6 +115,20 @@ func (dat *IOdata) CoreAlias() error {
 			msg := fmt.Sprintf("%s removed the **%s** alias.", u.StringPretty(), caller)
 			dat.msgEmbed = embedCreator(msg, ColorMaroon)
 			return nil
+		} else if disable {
+			if err := alias.Disable(); err != nil {
+				return err
+			}
+			msg := fmt.Sprintf("%s disabled the global **%s** alias for this guild.", u.StringPretty(), caller)
+			dat.msgEmbed = embedCreator(msg, ColorMaroon)
+			return nil
+		} else if enable {
+			if err := alias.Enable(); err != nil {
+				return err
+			}
+			msg := fmt.Sprintf("%s enabled the global **%s** alias for this guild.", u.StringPretty(), caller)
+			dat.msgEmbed = embedCreator(msg, ColorGreen)
+			return nil
 		}
 	} else if list {
 		var err error
@@ -107,6 +151,8 @@ func AliasNew(caller, link, serverID string, user *User) *Alias {
 		Linked:   link,
 		ServerID: serverID,
 		AddedBy:  user.Basic(),
+
+		Placeholders: true,
 	}
 }
 
@@ -116,8 +162,11 @@ func (a *Alias) Update() error {
 	var c = make(map[string]interface{})
 	q["caller"] = a.Caller
 	c["$set"] = bson.M{
-		"linked":  a.Linked,
-		"addedby": a.AddedBy,
+		"linked":   a.Linked,
+		"disabled": a.Disabled,
+		"addedby":  a.AddedBy,
+
+		"placeholders": a.Placeholders,
 	}
 
 	dbdat := DBdataCreate(a.ServerID, CollectionAlias, a, q, c)
@@ -150,7 +199,9 @@ func (a *Alias) Get() error {
 	a.ID = alias.ID
 	a.Caller = alias.Caller
 	a.Linked = alias.Linked
+	a.Disabled = alias.Disabled
 	a.AddedBy = alias.AddedBy
+	a.Placeholders = alias.Placeholders
 
 	return nil
 }
@@ -194,24 +245,335 @@ func (a *Alias) Check() (string, error) {
 	return a.Linked, nil
 }
 
+// Disable hides a global alias within the guild.
+func (a *Alias) Disable() error {
+	if a.ServerID == AliasGlobal {
+		return errors.New("global aliases are removed, not disabled")
+	}
+
+	global := &Alias{Caller: a.Caller, ServerID: AliasGlobal}
+	if err := global.Get(); err != nil {
+		if err == mgo.ErrNotFound {
+			return fmt.Errorf("no global alias named **%s**", a.Caller)
+		}
+		return err
+	}
+
+	a.Linked = ""
+	a.Disabled = true
+	return a.Update()
+}
+
+// Enable removes the guild's entry disabling a global alias.
+func (a *Alias) Enable() error {
+	if err := a.Get(); err != nil {
+		if err == mgo.ErrNotFound {
+			return fmt.Errorf("**%s** is not disabled", a.Caller)
+		}
+		return err
+	} else if !a.Disabled {
+		return fmt.Errorf("**%s** is not disabled", a.Caller)
+	}
+
+	return a.Remove()
+}
+
 // List prints out all currently accessible links.
 func (a *Alias) List() (string, error) {
-	aliases, err := a.GetAll()
-	if err != nil {
+	local, err := a.GetAll()
+	if err != nil && err != ErrNoAliases {
 		return "", err
 	}
 
+	// Global aliases are listed after the guild's, unless global is being listed.
+	var globals []Alias
+	if a.ServerID != AliasGlobal {
+		global := &Alias{ServerID: AliasGlobal}
+		if globals, err = global.GetAll(); err != nil && err != ErrNoAliases {
+			return "", err
+		}
+	}
+
+	if len(local) == 0 && len(globals) == 0 {
+		return "", ErrNoAliases
+	}
+
+	var overrides = make(map[string]Alias)
 	var msg = "Current aliases:\n"
-	for _, a := range aliases {
+	for _, a := range local {
+		overrides[a.Caller] = a
+		if a.Disabled {
+			continue
+		}
 		msg += fmt.Sprintf("\n\t[%s]   ->   [%s]", a.Caller, a.Linked)
 	}
+
+	if len(globals) > 0 {
+		msg += "\n\nGlobal aliases:\n"
+		for _, g := range globals {
+			var status string
+			if o, ok := overrides[g.Caller]; ok {
+				status = "  (overridden)"
+				if o.Disabled {
+					status = "  (disabled)"
+				}
+			}
+			msg += fmt.Sprintf("\n\t[%s]   ->   [%s]%s", g.Caller, g.Linked, status)
+		}
+	}
 	msg += "\n\nUse [left] text to perform [right] text."
 	return "```" + msg + "```", nil
 }
 
+// aliasFind gets the alias a guild uses for caller. A guild's alias takes priority
+// over a global alias and a disabled entry in the guild hides the global alias.
+func aliasFind(serverID, caller string) (*Alias, error) {
+	if serverID != AliasGlobal {
+		local := &Alias{Caller: caller, ServerID: serverID}
+		if err := local.Get(); err == nil {
+			if local.Disabled {
+				return nil, mgo.ErrNotFound
+			}
+			return local, nil
+		} else if err != mgo.ErrNotFound {
+			return nil, err
+		}
+	}
+
+	global := &Alias{Caller: caller, ServerID: AliasGlobal}
+	if err := global.Get(); err != nil {
+		return nil, err
+	}
+	return global, nil
+}
+
+// Chain follows the linked command through any other aliases, verifying
+// that it doesn't loop back on itself or go deeper than allowed.
+func (a *Alias) Chain() error {
+	var seen = []string{a.Caller}
+	var linked = a.Linked
+
+	for {
+		_, tokens := strToCommands(linked, "")
+		if len(tokens) == 0 {
+			return nil
+		}
+
+		next := tokens[0]
+		for _, s := range seen {
+			if s == next {
+				return ErrAliasCycle(append(seen, next))
+			}
+		}
+
+		alias, err := aliasFind(a.ServerID, next)
+		if err != nil {
+			if err == mgo.ErrNotFound {
+				return nil
+			}
+			return err
+		} else if len(seen) >= aliasDepthMax {
+			return ErrAliasDepth
+		}
+
+		seen = append(seen, next)
+		linked = alias.Linked
+	}
+}
+
+// aliasResolve converts io.io through as many aliases as it links to.
+func aliasResolve(dat *IOdata) error {
+	var seen []string
+	for len(dat.io) > 0 {
+		alias, err := aliasFind(dat.guild.ID, dat.io[0])
+		if err != nil {
+			if err == mgo.ErrNotFound {
+				return nil
+			}
+			return err
+		}
+
+		// Guild overrides can link global aliases into a loop after creation.
+		for _, s := range seen {
+			if s == alias.Caller {
+				return ErrAliasCycle(append(seen, alias.Caller))
+			}
+		}
+		if len(seen) >= aliasDepthMax {
+			return ErrAliasDepth
+		}
+		seen = append(seen, alias.Caller)
+
+		if dat.io, err = aliasConv(dat, alias); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks the placeholders in the linked command without any arguments.
+func (a *Alias) Validate() error {
+	aa := aliasArgs{caller: a.Caller, dry: true}
+	_, err := aa.convert(a.Linked)
+	return err
+}
+
+// aliasArgs holds the values that can be substituted into an alias' linked command.
+type aliasArgs struct {
+	caller  string   // Alias being processed, used for errors.
+	args    []string // Arguments supplied after the alias.
+	user    string   // Mention of the user calling the alias.
+	channel string   // Mention of the channel the alias was called in.
+	dry     bool     // Validation only, missing arguments are not errors.
+}
+
 // Convert a Caller to a Link and return new io.io
-func aliasConv(dat *IOdata, linked string) []string {
-	newTxt := strings.Replace(dat.input, dat.io[0], linked, 1)
-	_, cmds := strToCommands(newTxt, dat.cmdPrefix)
-	return cmds
+func aliasConv(dat *IOdata, alias *Alias) ([]string, error) {
+	if !alias.Placeholders {
+		_, cmds := strToCommands(alias.Linked, "")
+		return append(cmds, dat.io[1:]...), nil
+	}
+
+	aa := aliasArgs{
+		caller: alias.Caller,
+		args:   dat.io[1:],
+		user:   "<@" + dat.user.ID + ">",
+	}
+	if dat.msg != nil {
+		aa.channel = "<#" + dat.msg.ChannelID + ">"
+	}
+
+	return aa.convert(alias.Linked)
+}
+
+// convert expands the linked command into a new io.io. Links without any
+// placeholders have the arguments appended to the end like before.
+func (aa *aliasArgs) convert(linked string) ([]string, error) {
+	var cmds []string
+	var templated bool
+
+	_, tokens := strToCommands(linked, "")
+	for _, tok := range tokens {
+		// Keep each argument as its own token so quoted text isn't split.
+		if tok == "$@" {
+			cmds = append(cmds, aa.args...)
+			templated = true
+			continue
+		}
+
+		t, found, err := aa.expand(tok)
+		if err != nil {
+			return nil, err
+		} else if found {
+			templated = true
+			// Placeholders that resolved to nothing are dropped.
+			if t == "" {
+				continue
+			}
+		}
+		cmds = append(cmds, t)
+	}
+
+	if !templated {
+		cmds = append(cmds, aa.args...)
+	}
+	return cmds, nil
+}
+
+// expand substitutes all placeholders within a single token.
+func (aa *aliasArgs) expand(tok string) (string, bool, error) {
+	var buf bytes.Buffer
+	var found bool
+
+	for i := 0; i < len(tok); i++ {
+		if tok[i] != '$' || i+1 == len(tok) {
+			buf.WriteByte(tok[i])
+			continue
+		}
+
+		var name, def string
+		var hasDef bool
+		next := tok[i+1]
+		switch {
+		case next == '$':
+			// Escaped, "$$" is a literal "$".
+			buf.WriteByte('$')
+			i++
+			continue
+		case next == '{':
+			end := strings.IndexByte(tok[i:], '}')
+			if end < 0 {
+				return "", false, fmt.Errorf("alias **%s** has an unclosed `${`", aa.caller)
+			}
+			name = tok[i+2 : i+end]
+			if n := strings.IndexByte(name, ':'); n >= 0 {
+				name, def, hasDef = name[:n], name[n+1:], true
+			}
+			i += end
+		case next == '@':
+			name = "@"
+			i++
+		case isDigit(next):
+			j := i + 1
+			for j < len(tok) && isDigit(tok[j]) {
+				j++
+			}
+			name = tok[i+1 : j]
+			i = j - 1
+		case isLetter(next):
+			j := i + 1
+			for j < len(tok) && isLetter(tok[j]) {
+				j++
+			}
+			name = tok[i+1 : j]
+			i = j - 1
+		default:
+			buf.WriteByte('$')
+			continue
+		}
+
+		val, ok, err := aa.value(name)
+		if err != nil {
+			return "", false, err
+		} else if !ok {
+			if hasDef {
+				val = def
+			} else if name != "@" && !aa.dry {
+				return "", false, ErrAliasArgMissing(aa.caller, name)
+			}
+		}
+
+		found = true
+		buf.WriteString(val)
+	}
+
+	return buf.String(), found, nil
+}
+
+// value looks up a placeholder by name, false is returned if it wasn't supplied.
+func (aa *aliasArgs) value(name string) (string, bool, error) {
+	switch strings.ToLower(name) {
+	case "@":
+		return strings.Join(aa.args, " "), len(aa.args) > 0, nil
+	case "user":
+		return aa.user, aa.user != "", nil
+	case "channel":
+		return aa.channel, aa.channel != "", nil
+	}
+
+	n, err := strconv.Atoi(name)
+	if err != nil || n < 1 {
+		return "", false, ErrAliasBadPlaceholder(aa.caller, name)
+	} else if n > len(aa.args) {
+		return "", false, nil
+	}
+	return aa.args[n-1], true, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
 }
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"time"
 
 	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -16,39 +18,96 @@ import (
 
 // Channel holds a channels GuildID and ChannelID
 type Channel struct {
-	GuildID     string
-	GuildName   string
-	ChannelID   string
-	ChannelName string
+	GuildID      string
+	GuildName    string
+	ChannelID    string
+	ChannelName  string
+	WebhookID    string        // Webhook used to relay messages, empty if not permitted.
+	WebhookToken string        `json:"-"`
+	Rules        AllianceRules // Moderation of this side of an alliance.
+	IRC          *IRCEndpoint  `bson:"irc,omitempty"` // Set if the member is an IRC channel.
 }
 
-// Alliance holds alliance data between two channels.
+// Alliance holds alliance data between a hub of guild channels.
 type Alliance struct {
-	ID     bson.ObjectId `bson:"_id,omitempty"`
-	Name   string
-	Key    string
-	PartyA Channel
-	Party1 Channel
+	ID      bson.ObjectId `bson:"_id,omitempty"`
+	Name    string
+	Owner   string    // Guild ID of the guild that created the alliance.
+	Members []Channel // Channels that messages are relayed between.
+
+	// Legacy two-party alliances, converted to Members when loaded.
+	PartyA Channel `bson:"partya,omitempty" json:"-"`
+	Party1 Channel `bson:"party1,omitempty" json:"-"`
+}
+
+// Relay links a message sent in an alliance channel to the copies sent to
+// the other members, so edits and deletes can follow the original.
+type Relay struct {
+	ID          bson.ObjectId `bson:"_id,omitempty"`
+	Alliance    string
+	SourceID    string // Message ID of the original.
+	ChannelID   string // Channel of the original.
+	Username    string
+	Attachments []string // Attachment IDs of the original.
+	Copies      []RelayCopy
+	Date        time.Time
+}
+
+// RelayCopy is a relayed copy of a message.
+type RelayCopy struct {
+	ChannelID   string
+	MessageID   string
+	WebhookID   string   // Set if the copy was posted with a webhook.
+	Token       string   // Token of the webhook.
+	Attachments []string // Attachment IDs of the copy, in the order of the original's.
 }
 
 // Errors
 var (
-	ErrAllianceInit = errors.New("alliance is already initialised")
+	ErrAllianceInit      = errors.New("alliance is already initialised")
+	ErrAllianceNotFound  = errors.New("no alliance exists with that name")
+	ErrAllianceNotMember = errors.New("this guild isn't a member of that alliance")
+	ErrAllianceName      = errors.New("need to supply an alliance name ('--name')")
 )
 
 // CoreAlliance handles all alliance COMMAND actions
 func (cfg *Config) CoreAlliance(dat *IOdata) error {
-	var name, key string
-	var help, list, init, delete bool
+	var name, key, expires, restrict, revoke, irc, ircRemove, nick string
+	var help, list, init, invite, pending, leave, delete, rules, ircTLS bool
+	var uses = 1
+	var rc = allianceRulesChange{rate: -1}
 
 	fl := getopt.New()
 
-	fl.FlagLong(&delete, "delete", 'd', "Delete an Alliance.")
+	fl.FlagLong(&delete, "delete", 'd', "Delete an Alliance for every member.")
 	fl.FlagLong(&name, "name", 'n', "Alliance Name.")
 	fl.FlagLong(&key, "key", 'k', "Key to Join Alliance.")
 	fl.FlagLong(&init, "init", 0, "Initialize a new Alliance.")
+	fl.FlagLong(&invite, "invite", 'i', "Create a key for another guild to join.")
+	fl.FlagLong(&uses, "uses", 0, "Times the key can be used, 0 for unlimited. Default: 1")
+	fl.FlagLong(&expires, "expires", 0, "Key expires after: 30m, 2h, 1d. Default: 1d")
+	fl.FlagLong(&restrict, "guild", 'g', "Guild ID that is the only one able to use the key.")
+	fl.FlagLong(&pending, "pending", 'p', "List the keys that haven't expired.")
+	fl.FlagLong(&revoke, "revoke", 0, "Key to revoke.")
+	fl.FlagLong(&leave, "leave", 0, "Leave an Alliance, it continues for the other members.")
 	fl.FlagLong(&help, "help", 'h', "This menus")
-	fl.FlagLong(&list, "list", 'l', "List Guilds available.")
+	fl.FlagLong(&list, "list", 'l', "List Guilds available and current Alliances.")
+
+	// IRC channels bridged into an alliance.
+	fl.FlagLong(&irc, "irc", 0, "IRC channel to bridge: irc.example.net:6667/#channel")
+	fl.FlagLong(&nick, "nick", 0, "Nick used on IRC. Default: SchiNET")
+	fl.FlagLong(&ircTLS, "tls", 0, "Connect to IRC with TLS.")
+	fl.FlagLong(&ircRemove, "irc-remove", 0, "IRC channel to remove: irc.example.net:6667/#channel")
+
+	// Moderation of this guild's side.
+	fl.FlagLong(&rules, "rules", 0, "Show the moderation rules of this guild's side.")
+	fl.FlagLong(&rc.mute, "mute", 0, "User to stop relaying to and from this guild.")
+	fl.FlagLong(&rc.unmute, "unmute", 0, "User to relay again.")
+	fl.FlagLong(&rc.filter, "filter", 0, "Words, comma separated, that stop messages being relayed here.")
+	fl.FlagLong(&rc.unfilter, "unfilter", 0, "Words, comma separated, to remove from the filter.")
+	fl.FlagLong(&rc.mentions, "mentions", 0, "Mentions relayed here: strip, keep")
+	fl.FlagLong(&rc.rate, "rate", 0, "Messages per minute each user here can relay, 0 for no limit.")
+	fl.FlagLong(&rc.overflow, "overflow", 0, "Messages over the rate: drop, queue")
 
 	if err := fl.Getopt(dat.io, nil); err != nil {
 		return err
@@ -69,57 +128,109 @@ func (cfg *Config) CoreAlliance(dat *IOdata) error {
 		name = strings.ToLower(name)
 	}
 
-	// Handle the various commands: LIST, HELP, INIT, AND DELETE
+	// Handle the various commands: LIST, HELP, INIT, INVITE, JOIN, LEAVE, AND DELETE
 	if list {
-		dat.msgEmbed = embedCreator(cfg.Core.GuildsString(), ColorBlue)
+		dat.msgEmbed = embedCreator(cfg.Core.GuildsString()+"\n"+cfg.AllianceList(dat.guild.ID), ColorBlue)
 		return nil
 	} else if help {
 		dat.output = Help(fl, "", "")
 		return nil
-	} else if init {
-		if err := cfg.AllianceInit(name, dat.guild); err != nil {
+	} else if init || invite {
+		if init {
+			if err := cfg.AllianceInit(name, dat.guild); err != nil {
+				return err
+			}
+		}
+
+		d := allianceKeyDuration
+		if expires != "" {
+			var err error
+			if d, err = durationParse(expires); err != nil {
+				return err
+			}
+		}
+
+		k, err := cfg.AllianceKeyNew(name, dat.guild.ID, restrict, uses, d)
+		if err != nil {
+			return err
+		}
+		dat.msgEmbed = embedCreator(fmt.Sprintf("Pass this key to the guild joining:\n**%s**\n\n%s", k.Key, k.String()), ColorGreen)
+		return nil
+	} else if irc != "" {
+		if err := cfg.AllianceIRCAdd(name, dat.guild.ID, irc, nick, ircTLS); err != nil {
 			return err
 		}
-		passkey := fmt.Sprintf("Pass this key to other guild:\n**%s**", dat.guild.ID)
-		dat.msgEmbed = embedCreator(passkey, ColorGreen)
+		dat.output = "IRC channel added, connecting."
 		return nil
-	} else if delete {
-
-		if err := cfg.AllianceBreak(name); err != nil {
+	} else if ircRemove != "" {
+		if err := cfg.AllianceIRCRemove(name, dat.guild.ID, ircRemove, ircTLS); err != nil {
+			return err
+		}
+		dat.output = "IRC channel removed."
+		return nil
+	} else if pending {
+		msg, err := cfg.AllianceKeyList(dat.guild.ID)
+		if err != nil {
+			return err
+		}
+		dat.msgEmbed = embedCreator(msg, ColorBlue)
+		return nil
+	} else if revoke != "" {
+		if err := cfg.AllianceKeyRevoke(revoke, dat.guild.ID); err != nil {
 			return err
 		}
+		dat.output = "Key revoked."
+		return nil
+	} else if rules || rc.set() {
+		msg, err := cfg.AllianceModerate(name, dat.guild.ID, rc)
+		if err != nil {
+			return err
+		}
+		dat.msgEmbed = embedCreator(msg, ColorBlue)
+		return nil
+	} else if leave {
+		return cfg.AllianceLeave(name, dat.guild.ID)
+	} else if delete {
+		return cfg.AllianceBreak(name, dat.guild.ID)
 	} else if key != "" {
-		err := cfg.AllianceJoin(name, key, dat.guild)
-		return err
+		return cfg.AllianceJoin(name, key, dat.guild)
 	}
 
 	return nil
 }
 
-// AllianceInit creates a new alliance.
+// AllianceInit creates a new alliance with the guild as its first member.
 func (cfg *Config) AllianceInit(name string, guild *godbot.Guild) error {
 	// Check if Initialized Alliance
 	if name == "" {
-		return errors.New("need to supply an alliance name ('--name')")
-	}
-
-	if ok := cfg.AlliancePending(name, guild.ID); ok {
-		return ErrAllianceInit
+		return ErrAllianceName
 	}
 
 	if ok := cfg.AllianceExists(name); ok {
 		return errors.New("an alliance with that name already exists")
 	}
 
+	ch, err := cfg.Core.Session.GuildChannelCreate(guild.ID, name, "text")
+	if err != nil {
+		return err
+	}
+
 	var ally = Alliance{
-		Name: name,
-		Key:  guild.ID,
-		PartyA: Channel{
-			GuildID:   guild.ID,
-			GuildName: guild.Name,
-		},
+		Name:  name,
+		Owner: guild.ID,
+		Members: []Channel{{
+			GuildID:     guild.ID,
+			GuildName:   guild.Name,
+			ChannelID:   ch.ID,
+			ChannelName: ch.Name,
+		}},
 	}
-	cfg.pending = append(cfg.pending, ally)
+	ally.Webhooks(cfg.Core.Session)
+
+	if err := ally.Update(); err != nil {
+		return err
+	}
+	cfg.Alliances = append(cfg.Alliances, ally)
 
 	return nil
 }
@@ -127,119 +238,393 @@ func (cfg *Config) AllianceInit(name string, guild *godbot.Guild) error {
 // AllianceJoin allows you to use another's key to join.
 func (cfg *Config) AllianceJoin(name, key string, guild *godbot.Guild) error {
 	if name == "" {
-		return errors.New("need to supply an alliance name ('--name')")
-	} else if ok := cfg.AlliancePending(name, key); !ok {
-		return errors.New("alliance hasn't been initialized with ('--init') or ('--key') is bad")
-	} else if key == guild.ID {
-		return errors.New("you cannot ally yourself")
+		return ErrAllianceName
 	}
 
-	var ally Alliance
-	var loc int
-	for n, a := range cfg.pending {
-		if a.Key == key {
-			ally = a
-			loc = n
-		}
+	ally := cfg.AllianceGet(name)
+	if ally == nil {
+		return ErrAllianceNotFound
+	} else if ally.Member(guild.ID) >= 0 {
+		return errors.New("this guild is already a member of that alliance")
 	}
 
-	// Create Channel here.
-	cha, err := cfg.Core.Session.GuildChannelCreate(ally.PartyA.GuildID, name, "text")
-	if err != nil {
+	var k = &AllianceKey{}
+	if err := k.Get(name, key); err != nil {
+		return err
+	} else if err = k.Valid(guild.ID); err != nil {
 		return err
 	}
 
-	// Create channel in parent guild.
-	ch1, err := cfg.Core.Session.GuildChannelCreate(guild.ID, name, "text")
-	if err != nil {
+	// Claimed before anything is created, so a key can't be spent twice.
+	if err := k.Use(); err != nil {
 		return err
 	}
 
-	ally.PartyA.ChannelID = cha.ID
-	ally.PartyA.ChannelName = cha.Name
+	// Create channel in the joining guild.
+	ch, err := cfg.Core.Session.GuildChannelCreate(guild.ID, name, "text")
+	if err != nil {
+		allianceKeyRelease(k)
+		return err
+	}
 
-	var party1 = Channel{
+	ally.Members = append(ally.Members, Channel{
 		GuildID:     guild.ID,
 		GuildName:   guild.Name,
-		ChannelID:   ch1.ID,
-		ChannelName: ch1.Name,
-	}
+		ChannelID:   ch.ID,
+		ChannelName: ch.Name,
+	})
+	ally.Webhooks(cfg.Core.Session)
 
-	ally.Party1 = party1
-
-	// Remove from pending list.
-	cfg.pending = append(cfg.pending[:loc], cfg.pending[loc+1:]...)
-	cfg.Alliances = append(cfg.Alliances, ally)
 	if err := ally.Update(); err != nil {
+		ally.Members = ally.Members[:len(ally.Members)-1]
+		if _, cerr := cfg.Core.Session.ChannelDelete(ch.ID); cerr != nil {
+			fmt.Println("Removing the channel of a failed alliance join: " + cerr.Error())
+		}
+		allianceKeyRelease(k)
 		return err
 	}
 
-	var msg = fmt.Sprintf("The [**%s**] alliance been created!", ally.Name)
-	embed := embedCreator(msg, ColorGreen)
-	cfg.Core.Session.ChannelMessageSendEmbed(ally.Party1.GuildID, embed)
-	cfg.Core.Session.ChannelMessageSendEmbed(ally.PartyA.GuildID, embed)
+	if err := k.Spent(); err != nil {
+		fmt.Println("Removing a used up alliance key: " + err.Error())
+	}
+
+	var msg = fmt.Sprintf("**%s** has joined the [**%s**] alliance!", guild.Name, ally.Name)
+	ally.Announce(cfg.Core.Session, embedCreator(msg, ColorGreen))
 
 	return nil
 }
 
-// AllianceExists looks up if an alliance already exists.
-func (cfg Config) AllianceExists(name string) bool {
-	for _, a := range cfg.Alliances {
-		/*
-			if a.PartyA.GuildID == partyA.GuildID || a.PartyA.GuildID == party1.GuildID {
-				if a.Party1.GuildID == partyA.GuildID || a.Party1.GuildID == party1.GuildID {
-					return true
-				}
-			}*/
+// allianceKeyRelease gives back the use of a key claimed by a failed join.
+func allianceKeyRelease(k *AllianceKey) {
+	if err := k.Release(); err != nil {
+		fmt.Println("Releasing an alliance key: " + err.Error())
+	}
+}
+
+// AllianceGet finds a current alliance by name, nil if it doesn't exist.
+func (cfg *Config) AllianceGet(name string) *Alliance {
+	for n, a := range cfg.Alliances {
 		if a.Name == name {
-			return true
+			return &cfg.Alliances[n]
 		}
 	}
-	return false
+	return nil
 }
 
-// AlliancePending checks if the alliance is in pending status.
-func (cfg *Config) AlliancePending(name, key string) bool {
-	for _, a := range cfg.pending {
-		if a.Name == name && a.Key == key {
-			return true
+// AllianceExists looks up if an alliance already exists.
+func (cfg *Config) AllianceExists(name string) bool {
+	return cfg.AllianceGet(name) != nil
+}
+
+// AllianceList prints the alliances a guild is a member of.
+func (cfg *Config) AllianceList(guildID string) string {
+	var msg string
+	for _, a := range cfg.Alliances {
+		if a.Member(guildID) < 0 {
+			continue
 		}
+		var names []string
+		for _, m := range a.Members {
+			names = append(names, m.GuildName)
+		}
+		msg += fmt.Sprintf("[**%s**] %s\n", a.Name, strings.Join(names, ", "))
+	}
+
+	if msg == "" {
+		return "Not a member of any alliances."
 	}
-	return false
+	return "Alliances:\n" + msg
 }
 
 // AllianceHandler will check if channel is an alliance and process messages.
 func (cfg *Config) allianceHandler(m *discordgo.Message) error {
-	var ally Alliance
-	var found bool
+	var ally *Alliance
 	cID := m.ChannelID
-	username := m.Author.Username
 
-	for _, a := range cfg.Alliances {
-		if a.PartyA.ChannelID == cID || a.Party1.ChannelID == cID {
-			ally = a
-			found = true
+	for n, a := range cfg.Alliances {
+		if a.Channel(cID) >= 0 {
+			ally = &cfg.Alliances[n]
+			break
 		}
 	}
 
 	// Not found? Return with no error.
-	if !found {
+	if ally == nil {
+		return nil
+	}
+
+	source := &ally.Members[ally.Channel(cID)]
+	return cfg.allianceFrom(ally.Name, source, m)
+}
+
+// allianceFrom relays a message under the rules of the side it came from.
+// Muted users aren't relayed, and the rate limit drops or queues messages.
+func (cfg *Config) allianceFrom(name string, source *Channel, m *discordgo.Message) error {
+	if source.Rules.IsMuted(m.Author.ID) {
+		return nil
+	}
+
+	delay, ok := cfg.allianceLimit(name, source, m.Author.ID)
+	if !ok {
 		return nil
+	} else if delay > 0 {
+		time.AfterFunc(delay, func() {
+			if err := cfg.allianceSend(name, m); err != nil {
+				fmt.Println("Relaying queued alliance message: " + err.Error())
+			}
+		})
+		return nil
+	}
+
+	return cfg.allianceSend(name, m)
+}
+
+// allianceSend relays a message to the other members of its alliance.
+func (cfg *Config) allianceSend(name string, m *discordgo.Message) error {
+	cID := m.ChannelID
+	ally := cfg.AllianceGet(name)
+	if ally == nil || ally.Channel(cID) < 0 {
+		return nil
+	}
+
+	var relay = Relay{
+		Alliance:  ally.Name,
+		SourceID:  m.ID,
+		ChannelID: cID,
+		Username:  m.Author.Username,
+		Date:      time.Now(),
+	}
+	for _, a := range m.Attachments {
+		relay.Attachments = append(relay.Attachments, a.ID)
+	}
+
+	// Attachments are downloaded once to be uploaded to each member.
+	files, err := webhookFiles(cfg.Core.Session, m.Attachments)
+	if err != nil {
+		fmt.Println("Downloading attachments to relay: " + err.Error())
+		files = nil
+	}
+
+	// Fan out to every other member of the alliance, that allows it.
+	source := ally.Members[ally.Channel(cID)]
+	for _, member := range ally.Members {
+		if member.ChannelID == cID || member.Rules.IsMuted(m.Author.ID) || !member.Rules.Allows(m.Content) {
+			continue
+		} else if member.IRC != nil {
+			content := member.Rules.Clean(relay.Content(m.Content))
+			if e := cfg.ircSend(&member, m.Author.Username, content, m.Attachments); e != nil {
+				err = e
+			}
+			continue
+		}
+		c, e := cfg.allianceRelay(&member, &relay, source.GuildName, m, files)
+		if e != nil {
+			err = e
+			continue
+		}
+		relay.Copies = append(relay.Copies, c)
+	}
+
+	// Remember the copies so edits and deletes can be relayed. Messages from IRC can't change.
+	if len(relay.Copies) > 0 && relay.SourceID != "" {
+		if e := relay.Insert(); e != nil {
+			return e
+		}
+	}
+	return err
+}
+
+// allianceRelay sends a copy of a message to a member of an alliance. Uses the
+// member's webhook so the author's name and avatar are kept, falling back to
+// plain text from the bot.
+func (cfg *Config) allianceRelay(member *Channel, relay *Relay, guildName string, m *discordgo.Message, files [][]byte) (RelayCopy, error) {
+	s := cfg.Core.Session
+	var c = RelayCopy{ChannelID: member.ChannelID}
+	content := member.Rules.Clean(relay.Content(m.Content))
+
+	if member.WebhookID != "" {
+		username := fmt.Sprintf("%s (%s)", m.Author.Username, guildName)
+		if r := []rune(username); len(r) > webhookNameSize {
+			username = string(r[:webhookNameSize])
+		}
+		var params = &discordgo.WebhookParams{
+			Content:  strings.TrimSpace(content),
+			Username: username,
+		}
+		if m.Author.Avatar != "" {
+			params.AvatarURL = m.Author.AvatarURL("")
+		}
+
+		// Forward embeds the author made, links create their own.
+		for _, e := range m.Embeds {
+			if e.Type == "rich" {
+				params.Embeds = append(params.Embeds, e)
+			}
+		}
+
+		// Too large to upload, link them instead.
+		var upload []*discordgo.File
+		if files == nil {
+			params.Content += relay.Links(m.Attachments)
+		}
+		for n, f := range files {
+			upload = append(upload, &discordgo.File{Name: m.Attachments[n].Filename, Reader: bytes.NewReader(f)})
+		}
+
+		msg, err := webhookSend(s, member.WebhookID, member.WebhookToken, params, upload)
+		if err == nil {
+			c.MessageID = msg.ID
+			c.WebhookID = member.WebhookID
+			c.Token = member.WebhookToken
+			for _, a := range msg.Attachments {
+				c.Attachments = append(c.Attachments, a.ID)
+			}
+			return c, nil
+		}
+		fmt.Println("Relaying with webhook, sending as text: " + err.Error())
 	}
 
-	var rcvID string
-	if ally.PartyA.ChannelID == cID {
-		rcvID = ally.Party1.ChannelID
-	} else {
-		rcvID = ally.PartyA.ChannelID
+	msg, err := s.ChannelMessageSend(member.ChannelID, relay.Format(content, m.Attachments))
+	if err != nil {
+		return c, err
 	}
+	c.MessageID = msg.ID
+	return c, nil
+}
 
+// allianceEdit updates the relayed copies of an edited message.
+func (cfg *Config) allianceEdit(m *discordgo.Message) error {
+	var relay = &Relay{}
+	if err := relay.Get(m.ID); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	// Attachments can only be removed by an edit.
+	var kept = make(map[string]bool)
+	for _, a := range m.Attachments {
+		kept[a.ID] = true
+	}
+
+	// Each side has its own rules for what is relayed to it.
+	var ally = cfg.AllianceGet(relay.Alliance)
+	var rules = func(channelID string) AllianceRules {
+		if ally == nil || ally.Channel(channelID) < 0 {
+			return AllianceRules{}
+		}
+		return ally.Members[ally.Channel(channelID)].Rules
+	}
+
+	var err error
+	var copies []RelayCopy
+	for _, c := range relay.Copies {
+		r := rules(c.ChannelID)
+		if !r.Allows(m.Content) {
+			// The edit is no longer allowed on that side.
+			if e := relayCopyDelete(cfg.Core.Session, c); e != nil {
+				err = e
+			}
+			continue
+		}
+		copies = append(copies, c)
+		n := len(copies) - 1
+
+		content := r.Clean(relay.Content(m.Content))
+		if c.WebhookID == "" {
+			if _, e := cfg.Core.Session.ChannelMessageEdit(c.ChannelID, c.MessageID, relay.Format(content, m.Attachments)); e != nil {
+				err = e
+			}
+			continue
+		}
+
+		content = strings.TrimSpace(content)
+		var attachments []string
+		if len(c.Attachments) == len(relay.Attachments) {
+			for i, a := range relay.Attachments {
+				if kept[a] {
+					attachments = append(attachments, c.Attachments[i])
+				}
+			}
+		} else {
+			// Attachments were relayed as links.
+			content += relay.Links(m.Attachments)
+		}
+
+		if e := webhookEdit(cfg.Core.Session, c.WebhookID, c.Token, c.MessageID, content, attachments); e != nil {
+			err = e
+			continue
+		}
+		if len(c.Attachments) == len(relay.Attachments) {
+			copies[n].Attachments = attachments
+		}
+	}
+
+	relay.Copies = copies
+	relay.Attachments = nil
+	for _, a := range m.Attachments {
+		relay.Attachments = append(relay.Attachments, a.ID)
+	}
+	if e := relay.Update(); e != nil {
+		return e
+	}
+	return err
+}
+
+// allianceDelete removes the relayed copies of a deleted message.
+func (cfg *Config) allianceDelete(msgID string) error {
+	var relay = &Relay{}
+	if err := relay.Get(msgID); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	var err error
+	for _, c := range relay.Copies {
+		if e := relayCopyDelete(cfg.Core.Session, c); e != nil {
+			err = e
+		}
+	}
+
+	if e := relay.Delete(); e != nil {
+		return e
+	}
+	return err
+}
+
+// relayCopyDelete removes a relayed copy of a message.
+func relayCopyDelete(s *discordgo.Session, c RelayCopy) error {
+	if c.WebhookID != "" {
+		return webhookDelete(s, c.WebhookID, c.Token, c.MessageID)
+	}
+	return s.ChannelMessageDelete(c.ChannelID, c.MessageID)
+}
+
+// Format creates the text of a message relayed by the bot from converted content.
+func (relay *Relay) Format(content string, attachments []*discordgo.MessageAttachment) string {
+	return "[ally]**" + relay.Username + "** --> " + content + "\n" + relay.Links(attachments)
+}
+
+// Links lists the URLs of attachments that can't be uploaded.
+func (relay *Relay) Links(attachments []*discordgo.MessageAttachment) string {
+	var links string
+	for _, a := range attachments {
+		links += "\n" + a.URL
+	}
+	return links
+}
+
+// Content converts the text of a message to be relayed.
+func (relay *Relay) Content(text string) string {
 	// Convert from an @mention to plain text
 	// TAG: TODO
 
 	// Scan for @mentions
 	var content string
-	cSplit := strings.Split(m.Content, " ")
+	cSplit := strings.Split(text, " ")
 	for _, w := range cSplit {
 		// Potentially a user.
 		if strings.HasPrefix(w, "@") {
@@ -251,25 +636,110 @@ func (cfg *Config) allianceHandler(m *discordgo.Message) error {
 		}
 		content += w + " "
 	}
+	return content
+}
 
-	var nc = "[ally]**" + username + "** --> " + content + "\n"
-	for _, a := range m.Attachments {
-		nc += "\n" + a.URL
+// Insert a relay into the database.
+func (relay *Relay) Insert() error {
+	var dbdat = DBdataCreate("config", CollectionRelays, relay, nil, nil)
+	return dbdat.dbInsert()
+}
+
+// Update the attachments and copies of a relay in the database.
+func (relay *Relay) Update() error {
+	var q = make(map[string]interface{})
+	var c = make(map[string]interface{})
+
+	q["sourceid"] = relay.SourceID
+	c["$set"] = bson.M{
+		"attachments": relay.Attachments,
+		"copies":      relay.Copies,
 	}
-	if _, err := cfg.Core.Session.ChannelMessageSend(rcvID, nc); err != nil {
+
+	var dbdat = DBdataCreate("config", CollectionRelays, relay, q, c)
+	return dbdat.dbEdit(Relay{})
+}
+
+// Get a relay by the ID of the original message.
+func (relay *Relay) Get(sourceID string) error {
+	var q = make(map[string]interface{})
+	q["sourceid"] = sourceID
+
+	var dbdat = DBdataCreate("config", CollectionRelays, Relay{}, q, nil)
+	if err := dbdat.dbGet(Relay{}); err != nil {
 		return err
 	}
+
+	*relay = dbdat.Document.(Relay)
 	return nil
 }
 
-// AllianceBreak cancels an alliance.
-func (cfg *Config) AllianceBreak(name string) error {
+// Delete a relay from the database.
+func (relay *Relay) Delete() error {
+	var q = make(map[string]interface{})
+	q["sourceid"] = relay.SourceID
+
+	var dbdat = DBdataCreate("config", CollectionRelays, relay, q, nil)
+	return dbdat.dbDelete()
+}
+
+// AllianceLeave removes a guild from an alliance, the alliance continues for
+// the remaining members.
+func (cfg *Config) AllianceLeave(name, guildID string) error {
+	ally := cfg.AllianceGet(name)
+	if ally == nil {
+		return ErrAllianceNotFound
+	}
+
+	n := ally.Member(guildID)
+	if n < 0 {
+		return ErrAllianceNotMember
+	}
+
+	// Last guild out breaks the alliance, IRC channels can't keep it going.
+	var guilds int
+	for _, m := range ally.Members {
+		if m.IRC == nil {
+			guilds++
+		}
+	}
+	if guilds == 1 {
+		ally.Owner = guildID
+		return cfg.AllianceBreak(name, guildID)
+	}
+
+	member := ally.Members[n]
+	ally.Members = append(ally.Members[:n], ally.Members[n+1:]...)
+
+	// Pass ownership on if the creator is leaving.
+	if ally.Owner == guildID {
+		for _, m := range ally.Members {
+			if m.IRC == nil {
+				ally.Owner = m.GuildID
+				break
+			}
+		}
+	}
+
+	if err := ally.Update(); err != nil {
+		return err
+	}
+
+	var msg = fmt.Sprintf("**%s** has left the [**%s**] alliance.", member.GuildName, ally.Name)
+	ally.Announce(cfg.Core.Session, embedCreator(msg, ColorMaroon))
 
-	if ok := cfg.AllianceExists(name); !ok {
-		return errors.New("no alliance exists with that name")
+	// TAG: TODO - Error handling incase deletion fails.
+	if member.WebhookID != "" {
+		cfg.Core.Session.WebhookDelete(member.WebhookID)
 	}
+	cfg.Core.Session.ChannelDelete(member.ChannelID)
 
-	var cnt int
+	return nil
+}
+
+// AllianceBreak cancels an alliance for every member.
+func (cfg *Config) AllianceBreak(name, guildID string) error {
+	var cnt = -1
 	var ally Alliance
 	for n, a := range cfg.Alliances {
 		if a.Name == name {
@@ -278,26 +748,166 @@ func (cfg *Config) AllianceBreak(name string) error {
 		}
 	}
 
+	if cnt < 0 {
+		return ErrAllianceNotFound
+	} else if ally.Owner != guildID {
+		return errors.New("only the guild that created the alliance can delete it, use ('--leave') instead")
+	}
+
 	// Remove the alliance from the current maintained alliances.
 	cfg.Alliances = append(cfg.Alliances[:cnt], cfg.Alliances[cnt+1:]...)
 	if err := ally.Delete(); err != nil {
 		return err
 	}
+	if err := allianceKeysDelete(ally.Name); err != nil {
+		fmt.Println("Removing alliance keys: " + err.Error())
+	}
 
-	// Send out the notification to both server.
+	// Send out the notification to every server.
 	var msg = fmt.Sprintf("The [**%s**] alliance has fallen!", ally.Name)
 	embed := embedCreator(msg, ColorMaroon)
-	cfg.Core.Session.ChannelMessageSendEmbed(ally.Party1.GuildID, embed)
-	cfg.Core.Session.ChannelMessageSendEmbed(ally.PartyA.GuildID, embed)
+	for _, m := range ally.Members {
+		if m.IRC == nil {
+			cfg.Core.Session.ChannelMessageSendEmbed(m.GuildID, embed)
+		}
+	}
 
 	// Cleanup the channels and remove the alliance channel from each server.
 	// TAG: TODO - Error handling incase deletion fails.
-	cfg.Core.Session.ChannelDelete(ally.PartyA.ChannelID)
-	cfg.Core.Session.ChannelDelete(ally.Party1.ChannelID)
+	for _, m := range ally.Members {
+		if m.IRC != nil {
+			cfg.ircStop(m.ChannelID)
+			continue
+		}
+		if m.WebhookID != "" {
+			cfg.Core.Session.WebhookDelete(m.WebhookID)
+		}
+		cfg.Core.Session.ChannelDelete(m.ChannelID)
+	}
+
+	return nil
+}
+
+// AllianceIRCAdd bridges an IRC channel into an alliance.
+func (cfg *Config) AllianceIRCAdd(name, guildID, endpoint, nick string, useTLS bool) error {
+	ally := cfg.AllianceGet(name)
+	if ally == nil {
+		return ErrAllianceNotFound
+	} else if ally.Member(guildID) < 0 {
+		return ErrAllianceNotMember
+	}
+
+	e, err := ircParse(endpoint, nick, useTLS)
+	if err != nil {
+		return err
+	} else if ally.Channel(e.ID()) >= 0 {
+		return errors.New("that IRC channel is already part of the alliance")
+	}
+
+	// The guild bridging the channel moderates it with the rules of its side.
+	ally.Members = append(ally.Members, Channel{
+		GuildID:     guildID,
+		GuildName:   e.String(),
+		ChannelID:   e.ID(),
+		ChannelName: e.Channel,
+		IRC:         e,
+	})
+	if err := ally.Update(); err != nil {
+		return err
+	}
+
+	cfg.ircStart(ally)
+	var msg = fmt.Sprintf("**%s** has joined the [**%s**] alliance!", e.String(), ally.Name)
+	ally.Announce(cfg.Core.Session, embedCreator(msg, ColorGreen))
+	return nil
+}
+
+// AllianceIRCRemove removes an IRC channel from an alliance.
+func (cfg *Config) AllianceIRCRemove(name, guildID, endpoint string, useTLS bool) error {
+	ally := cfg.AllianceGet(name)
+	if ally == nil {
+		return ErrAllianceNotFound
+	} else if ally.Member(guildID) < 0 {
+		return ErrAllianceNotMember
+	}
+
+	e, err := ircParse(endpoint, "", useTLS)
+	if err != nil {
+		return err
+	}
+
+	n := ally.Channel(e.ID())
+	if n < 0 {
+		return errors.New("that IRC channel isn't part of the alliance")
+	}
 
+	ally.Members = append(ally.Members[:n], ally.Members[n+1:]...)
+	if err := ally.Update(); err != nil {
+		return err
+	}
+	cfg.ircStop(e.ID())
+
+	var msg = fmt.Sprintf("**%s** has left the [**%s**] alliance.", e.String(), ally.Name)
+	ally.Announce(cfg.Core.Session, embedCreator(msg, ColorMaroon))
 	return nil
 }
 
+// Member gets the position of a guild in the alliance, -1 if it isn't a member.
+func (ally *Alliance) Member(guildID string) int {
+	for n, m := range ally.Members {
+		if m.IRC == nil && m.GuildID == guildID {
+			return n
+		}
+	}
+	return -1
+}
+
+// Channel gets the position of a member by its channel, -1 if it isn't a member.
+func (ally *Alliance) Channel(channelID string) int {
+	for n, m := range ally.Members {
+		if m.ChannelID == channelID {
+			return n
+		}
+	}
+	return -1
+}
+
+// Webhooks sets up the webhook of each member used to relay messages. Members
+// that don't permit the bot to manage webhooks are relayed to as plain text.
+// Returns true if any member's webhook changed.
+func (ally *Alliance) Webhooks(s *discordgo.Session) bool {
+	var changed bool
+	for n, m := range ally.Members {
+		if m.IRC != nil {
+			continue
+		}
+		hook, err := webhookGet(s, m.ChannelID)
+		if err != nil {
+			fmt.Printf("Alliance webhook for %s, relaying as text: %s\n", m.GuildName, err.Error())
+			hook = &discordgo.Webhook{}
+		}
+
+		if hook.ID != m.WebhookID || hook.Token != m.WebhookToken {
+			ally.Members[n].WebhookID = hook.ID
+			ally.Members[n].WebhookToken = hook.Token
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Announce sends an embed to every channel of the alliance.
+func (ally *Alliance) Announce(s *discordgo.Session, embed *discordgo.MessageEmbed) {
+	for _, m := range ally.Members {
+		if m.IRC != nil {
+			continue
+		}
+		if _, err := s.ChannelMessageSendEmbed(m.ChannelID, embed); err != nil {
+			fmt.Println("Alliance announcement: " + err.Error())
+		}
+	}
+}
+
 // Update replicates changes to a database for a particular alliance.
 func (ally *Alliance) Update() error {
 	var err error
@@ -306,11 +916,11 @@ func (ally *Alliance) Update() error {
 
 	q["name"] = ally.Name
 	c["$set"] = bson.M{
-		"name":   ally.Name,
-		"key":    ally.Key,
-		"partya": ally.PartyA,
-		"party1": ally.Party1,
+		"name":    ally.Name,
+		"owner":   ally.Owner,
+		"members": ally.Members,
 	}
+	c["$unset"] = bson.M{"key": "", "partya": "", "party1": ""}
 
 	// Construct the the query for the database.
 	var dbdat = DBdataCreate("config", CollectionAlliances, ally, q, c)
@@ -363,7 +973,29 @@ func (cfg *Config) AlliancesLoad() error {
 	var doc Alliance
 	for _, d := range dbdat.Documents {
 		doc = d.(Alliance)
+
+		// Convert alliances from when they only had two parties.
+		if len(doc.Members) == 0 && doc.PartyA.ChannelID != "" {
+			doc.Owner = doc.PartyA.GuildID
+			doc.Members = []Channel{doc.PartyA, doc.Party1}
+			doc.PartyA, doc.Party1 = Channel{}, Channel{}
+			if err := doc.Update(); err != nil {
+				fmt.Println("Converting alliance: " + err.Error())
+			}
+		}
+
+		// Webhooks may have been removed, or permitted, while offline.
+		if doc.Webhooks(cfg.Core.Session) {
+			if err := doc.Update(); err != nil {
+				fmt.Println("Updating alliance webhooks: " + err.Error())
+			}
+		}
 		cfg.Alliances = append(cfg.Alliances, doc)
 	}
+
+	// Connect the IRC channels.
+	for n := range cfg.Alliances {
+		cfg.ircStart(&cfg.Alliances[n])
+	}
 	return nil
 }
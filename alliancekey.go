@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// allianceKeyDuration is how long keys last unless told otherwise.
+const allianceKeyDuration = 24 * time.Hour
+
+// allianceKeyBytes is how many random bytes make up a key.
+const allianceKeyBytes = 12
+
+// Errors for alliance keys.
+var (
+	ErrAllianceKey        = errors.New("alliance hasn't been initialized with ('--init') or ('--key') is bad")
+	ErrAllianceKeyExpired = errors.New("that key has expired, ask for a new one")
+	ErrAllianceKeyUsed    = errors.New("that key has been used up, ask for a new one")
+)
+
+// AllianceKey is a pending invitation for a guild to join an alliance.
+type AllianceKey struct {
+	ID       bson.ObjectId `bson:"_id,omitempty"`
+	Name     string        // Alliance the key joins.
+	Key      string
+	Creator  string // Guild ID that created the key.
+	Restrict string // Only this guild ID can use the key, empty for any.
+	Uses     int    // Times the key can be used, 0 for unlimited.
+	Used     int
+	Created  time.Time
+	Expires  time.Time
+}
+
+// AllianceKeyNew creates a key for another guild to join an alliance.
+func (cfg *Config) AllianceKeyNew(name, guildID, restrict string, uses int, d time.Duration) (*AllianceKey, error) {
+	if name == "" {
+		return nil, ErrAllianceName
+	} else if uses < 0 {
+		return nil, errors.New("uses can't be negative, 0 is unlimited")
+	}
+
+	ally := cfg.AllianceGet(name)
+	if ally == nil {
+		return nil, ErrAllianceNotFound
+	} else if ally.Member(guildID) < 0 {
+		return nil, ErrAllianceNotMember
+	} else if restrict != "" && ally.Member(restrict) >= 0 {
+		return nil, errors.New("that guild is already a member of the alliance")
+	}
+
+	// Keys are the only thing needed to join, they can't be guessable.
+	b := make([]byte, allianceKeyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	tn := time.Now()
+	var k = &AllianceKey{
+		Name:     name,
+		Key:      hex.EncodeToString(b),
+		Creator:  guildID,
+		Restrict: restrict,
+		Uses:     uses,
+		Created:  tn,
+		Expires:  tn.Add(d),
+	}
+
+	dbdat := DBdataCreate("config", CollectionAllyKeys, k, nil, nil)
+	if err := dbdat.dbInsert(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// AllianceKeyList prints the keys of the alliances a guild is a member of,
+// removing keys that have expired.
+func (cfg *Config) AllianceKeyList(guildID string) (string, error) {
+	dbdat := DBdataCreate("config", CollectionAllyKeys, AllianceKey{}, nil, nil)
+	if err := dbdat.dbGetAll(AllianceKey{}); err != nil && err != mgo.ErrNotFound {
+		return "", err
+	}
+
+	var msg string
+	for _, d := range dbdat.Documents {
+		k := d.(AllianceKey)
+		if ally := cfg.AllianceGet(k.Name); ally == nil || ally.Member(guildID) < 0 {
+			continue
+		}
+
+		if time.Now().After(k.Expires) {
+			if err := k.Delete(); err != nil {
+				return "", err
+			}
+			continue
+		}
+		msg += fmt.Sprintf("[**%s**] **%s** - %s\n", k.Name, k.Key, k.String())
+	}
+
+	if msg == "" {
+		return "No pending keys.", nil
+	}
+	return "Pending keys:\n\n" + msg, nil
+}
+
+// AllianceKeyRevoke removes a key of an alliance the guild is a member of.
+func (cfg *Config) AllianceKeyRevoke(key, guildID string) error {
+	var q = make(map[string]interface{})
+	q["key"] = key
+
+	var k = &AllianceKey{}
+	if err := k.get(q); err != nil {
+		return err
+	}
+
+	if ally := cfg.AllianceGet(k.Name); ally != nil && ally.Member(guildID) < 0 {
+		return ErrAllianceNotMember
+	}
+	return k.Delete()
+}
+
+// allianceKeysDelete removes every key of an alliance.
+func allianceKeysDelete(name string) error {
+	var q = make(map[string]interface{})
+	q["name"] = name
+
+	dbdat := DBdataCreate("config", CollectionAllyKeys, AllianceKey{}, q, nil)
+	if err := dbdat.dbGetWithLimit(AllianceKey{}, []string{"created"}, 0); err != nil {
+		return err
+	}
+
+	for _, d := range dbdat.Documents {
+		k := d.(AllianceKey)
+		if err := k.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String describes the limits of a key.
+func (k *AllianceKey) String() string {
+	var uses = "unlimited uses"
+	if k.Uses > 0 {
+		uses = fmt.Sprintf("%d of %d uses left", k.Uses-k.Used, k.Uses)
+	}
+
+	var msg = fmt.Sprintf("Expires: %s, %s", k.Expires.Format(time.UnixDate), uses)
+	if k.Restrict != "" {
+		msg += ", only for guild " + k.Restrict
+	}
+	return msg
+}
+
+// Valid checks that a guild can use the key.
+func (k *AllianceKey) Valid(guildID string) error {
+	if time.Now().After(k.Expires) {
+		return ErrAllianceKeyExpired
+	} else if k.Restrict != "" && k.Restrict != guildID {
+		return errors.New("that key is for another guild")
+	}
+	return nil
+}
+
+// Use claims a use of the key. The claim is a single update, so guilds
+// joining at once can't both spend the last use.
+func (k *AllianceKey) Use() error {
+	var q = make(map[string]interface{})
+	var c = make(map[string]interface{})
+	q["key"] = k.Key
+	q["expires"] = bson.M{"$gt": time.Now()}
+	if k.Uses > 0 {
+		q["used"] = bson.M{"$lt": k.Uses}
+	}
+	c["$inc"] = bson.M{"used": 1}
+
+	dbdat := DBdataCreate("config", CollectionAllyKeys, AllianceKey{}, q, c)
+	if err := dbdat.dbEdit(AllianceKey{}); err == mgo.ErrNotFound {
+		return ErrAllianceKeyUsed
+	} else if err != nil {
+		return err
+	}
+
+	d, err := handlerForInterface(AllianceKey{}, dbdat.Document)
+	if err != nil {
+		return err
+	}
+	*k = d.(AllianceKey)
+	return nil
+}
+
+// Release gives back a use claimed by a join that failed.
+func (k *AllianceKey) Release() error {
+	var q = make(map[string]interface{})
+	var c = make(map[string]interface{})
+	q["key"] = k.Key
+	c["$inc"] = bson.M{"used": -1}
+
+	dbdat := DBdataCreate("config", CollectionAllyKeys, AllianceKey{}, q, c)
+	if err := dbdat.dbEdit(AllianceKey{}); err != nil {
+		return err
+	}
+	k.Used--
+	return nil
+}
+
+// Spent removes the key once all of its uses are claimed.
+func (k *AllianceKey) Spent() error {
+	if k.Uses > 0 && k.Used >= k.Uses {
+		return k.Delete()
+	}
+	return nil
+}
+
+// Get a key for an alliance from the database.
+func (k *AllianceKey) Get(name, key string) error {
+	var q = make(map[string]interface{})
+	q["name"] = name
+	q["key"] = key
+	return k.get(q)
+}
+
+func (k *AllianceKey) get(q bson.M) error {
+	dbdat := DBdataCreate("config", CollectionAllyKeys, AllianceKey{}, q, nil)
+	if err := dbdat.dbGet(AllianceKey{}); err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrAllianceKey
+		}
+		return err
+	}
+
+	*k = dbdat.Document.(AllianceKey)
+	return nil
+}
+
+// Delete a key from the database.
+func (k *AllianceKey) Delete() error {
+	var q = make(map[string]interface{})
+	q["key"] = k.Key
+
+	dbdat := DBdataCreate("config", CollectionAllyKeys, k, q, nil)
+	return dbdat.dbDelete()
+}
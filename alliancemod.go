@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Constants for moderating alliances.
+const (
+	allianceRateWindow = time.Minute // Window the rate limit counts messages in.
+	allianceQueueMax   = 5           // Messages a user can have waiting to be relayed.
+)
+
+// allianceMention matches user, nickname, and role mentions.
+var allianceMention = regexp.MustCompile(`<@[!&]?[0-9]+>`)
+
+// AllianceRules are the moderation settings a guild applies to its side of an alliance.
+type AllianceRules struct {
+	Muted         []string // User IDs not relayed to or from this side.
+	Words         []string // Messages containing these aren't relayed to this side.
+	StripMentions bool     // Mentions relayed to this side are made plain text.
+	RateLimit     int      // Messages per minute a user on this side can relay, 0 for no limit.
+	Queue         bool     // Messages over the rate limit are queued instead of dropped.
+}
+
+// allianceRulesChange holds the changes requested to a side's rules.
+type allianceRulesChange struct {
+	mute, unmute       string
+	filter, unfilter   []string
+	mentions, overflow string
+	rate               int
+}
+
+// set is true if any changes were requested.
+func (rc allianceRulesChange) set() bool {
+	return rc.mute != "" || rc.unmute != "" || len(rc.filter) > 0 || len(rc.unfilter) > 0 ||
+		rc.mentions != "" || rc.overflow != "" || rc.rate >= 0
+}
+
+// AllianceModerate changes the rules of a guild's side of an alliance, and prints them.
+func (cfg *Config) AllianceModerate(name, guildID string, rc allianceRulesChange) (string, error) {
+	if name == "" {
+		return "", ErrAllianceName
+	}
+
+	ally := cfg.AllianceGet(name)
+	if ally == nil {
+		return "", ErrAllianceNotFound
+	}
+
+	n := ally.Member(guildID)
+	if n < 0 {
+		return "", ErrAllianceNotMember
+	}
+
+	if !rc.set() {
+		return ally.Members[n].Rules.String(ally.Name), nil
+	}
+
+	rules := ally.Members[n].Rules
+	if err := rules.Change(rc); err != nil {
+		return "", err
+	}
+
+	ally.Members[n].Rules = rules
+	if err := ally.Update(); err != nil {
+		return "", err
+	}
+	return rules.String(ally.Name), nil
+}
+
+// Change applies the requested changes to the rules.
+func (r *AllianceRules) Change(rc allianceRulesChange) error {
+	if rc.mute != "" {
+		id := allianceUserID(rc.mute)
+		if id == "" {
+			return errors.New("mention the user to mute")
+		} else if !r.IsMuted(id) {
+			r.Muted = append(r.Muted, id)
+		}
+	}
+
+	if rc.unmute != "" {
+		id := allianceUserID(rc.unmute)
+		for n, m := range r.Muted {
+			if m == id {
+				r.Muted = append(r.Muted[:n], r.Muted[n+1:]...)
+				break
+			}
+		}
+	}
+
+	for _, w := range rc.filter {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if w != "" && !strContains(r.Words, w) {
+			r.Words = append(r.Words, w)
+		}
+	}
+
+	for _, w := range rc.unfilter {
+		w = strings.ToLower(strings.TrimSpace(w))
+		for n, word := range r.Words {
+			if word == w {
+				r.Words = append(r.Words[:n], r.Words[n+1:]...)
+				break
+			}
+		}
+	}
+
+	switch strings.ToLower(rc.mentions) {
+	case "":
+	case "strip":
+		r.StripMentions = true
+	case "keep":
+		r.StripMentions = false
+	default:
+		return errors.New("mentions can be: strip, keep")
+	}
+
+	switch strings.ToLower(rc.overflow) {
+	case "":
+	case "drop":
+		r.Queue = false
+	case "queue":
+		r.Queue = true
+	default:
+		return errors.New("overflow can be: drop, queue")
+	}
+
+	if rc.rate >= 0 {
+		r.RateLimit = rc.rate
+	}
+	return nil
+}
+
+// allianceUserID gets the ID of a user to mute from a mention, or "irc:nick"
+// for users relayed from IRC.
+func allianceUserID(str string) string {
+	if strings.HasPrefix(str, "irc:") && len(str) > len("irc:") {
+		return str
+	}
+	return userIDClean(str)
+}
+
+// IsMuted checks if a user is muted.
+func (r *AllianceRules) IsMuted(userID string) bool {
+	return strContains(r.Muted, userID)
+}
+
+// Allows checks if a message can be relayed to this side.
+func (r *AllianceRules) Allows(text string) bool {
+	text = strings.ToLower(text)
+	for _, w := range r.Words {
+		if strings.Contains(text, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// Clean removes mass mentions from text relayed to this side, and other mentions
+// if they are stripped.
+func (r *AllianceRules) Clean(text string) string {
+	text = strings.Replace(text, "@everyone", "everyone", -1)
+	text = strings.Replace(text, "@here", "here", -1)
+
+	if !r.StripMentions {
+		return text
+	}
+
+	return allianceMention.ReplaceAllStringFunc(text, func(mention string) string {
+		if strings.HasPrefix(mention, "<@&") {
+			return "@role"
+		}
+		u := UserNew(nil)
+		if err := u.Get(userIDClean(mention)); err != nil {
+			return "@unknown"
+		}
+		return "@" + u.Username
+	})
+}
+
+// String prints the rules.
+func (r *AllianceRules) String(name string) string {
+	var muted []string
+	for _, id := range r.Muted {
+		muted = append(muted, "<@"+id+">")
+	}
+
+	var rate = "none"
+	if r.RateLimit > 0 {
+		overflow := "drop"
+		if r.Queue {
+			overflow = "queue"
+		}
+		rate = fmt.Sprintf("%d per minute, then %s", r.RateLimit, overflow)
+	}
+
+	mentions := "keep"
+	if r.StripMentions {
+		mentions = "strip"
+	}
+
+	return fmt.Sprintf("Rules for this side of [**%s**]:\n\nMuted: %s\nFiltered words: %s\nMentions: %s\nRate limit: %s",
+		name, strOrNone(strings.Join(muted, ", ")), strOrNone(strings.Join(r.Words, ", ")), mentions, rate)
+}
+
+// allianceLimit checks a user's rate limit on their side of an alliance. Returns
+// how long to wait before relaying, or false if the message is dropped.
+func (cfg *Config) allianceLimit(name string, side *Channel, userID string) (time.Duration, bool) {
+	limit := side.Rules.RateLimit
+	if limit <= 0 {
+		return 0, true
+	}
+
+	cfg.relayedMu.Lock()
+	defer cfg.relayedMu.Unlock()
+	if cfg.relayed == nil {
+		cfg.relayed = make(map[string][]time.Time)
+	}
+
+	key := name + ":" + side.GuildID + ":" + userID
+	tn := time.Now()
+
+	// Forget relays outside of the window, queued ones are in the future.
+	var recent []time.Time
+	var queued int
+	for _, t := range cfg.relayed[key] {
+		if tn.Sub(t) < allianceRateWindow {
+			recent = append(recent, t)
+		}
+		if t.After(tn) {
+			queued++
+		}
+	}
+
+	if len(recent) < limit {
+		cfg.relayed[key] = append(recent, tn)
+		return 0, true
+	} else if !side.Rules.Queue || queued >= allianceQueueMax {
+		cfg.relayed[key] = recent
+		return 0, false
+	}
+
+	// The next opening is a window after the relay that is limit places back.
+	next := recent[len(recent)-limit].Add(allianceRateWindow)
+	cfg.relayed[key] = append(recent, next)
+	return next.Sub(tn), true
+}
+
+// strContains checks if a slice has a string.
+func strContains(slice []string, str string) bool {
+	for _, s := range slice {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+// strOrNone returns "none" for empty strings.
+func strOrNone(str string) string {
+	if str == "" {
+		return "none"
+	}
+	return str
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/pborman/getopt/v2"
+)
+
+// Formats the archive can be exported in.
+const (
+	archiveJSONL = "jsonl"
+	archiveCSV   = "csv"
+	archiveHTML  = "html"
+)
+
+// archiveFormats are the formats accepted by --format.
+var archiveFormats = []string{archiveJSONL, archiveCSV, archiveHTML}
+
+// archivePasteMax is the largest export sent to a paste, the rest need the console.
+const archivePasteMax = 512 * 1024
+
+// ErrArchiveTooLarge stops an export that is over its limit.
+var ErrArchiveTooLarge = errors.New("too large for a paste, narrow the dates or export it on the console")
+
+// ArchiveRecord is an archived message as exported to JSON lines and CSV.
+type ArchiveRecord struct {
+	ID            string       `json:"message_id"`
+	Time          time.Time    `json:"time"`
+	Edited        *time.Time   `json:"edited,omitempty"`
+	ChannelID     string       `json:"channel_id"`
+	ChannelName   string       `json:"channel_name"`
+	UserID        string       `json:"user_id"`
+	Username      string       `json:"username"`
+	Discriminator string       `json:"discriminator"`
+	Content       string       `json:"content"`
+	Previous      []string     `json:"previous,omitempty"` // Earlier content of an edited message, oldest first.
+	Deleted       *time.Time   `json:"deleted,omitempty"`
+	DeletedBy     string       `json:"deleted_by,omitempty"` // ID of who deleted it, if known.
+	Attachments   []Attachment `json:"attachments,omitempty"`
+}
+
+// archiveExport picks the messages of a guild to export, and how.
+type archiveExport struct {
+	GuildID   string
+	GuildName string
+	Channel   string // Name or ID of a channel, every channel if empty.
+	Format    string
+	After     time.Time
+	Before    time.Time
+	Out       string // File written to by the console.
+	Max       int    // Most bytes written before stopping, no limit if 0.
+
+	files string // Directory stored attachments are copied to for HTML, none if empty.
+}
+
+// archiveFlags reads the options of an export, returning the words that are not
+// flags, or the usage if help was asked for.
+func archiveFlags(input []string) (ex *archiveExport, words []string, usage string, err error) {
+	var help bool
+	var after, before string
+	ex = &archiveExport{Format: archiveHTML}
+
+	fl := getopt.New()
+	fl.FlagLong(&ex.Format, "format", 'f', "Format: jsonl, csv, or html")
+	fl.FlagLong(&ex.Channel, "channel", 'c', "Only this channel, #mention or name")
+	fl.FlagLong(&after, "after", 'a', "Only messages after a date, YYYY-MM-DD")
+	fl.FlagLong(&before, "before", 'b', "Only messages before a date, YYYY-MM-DD")
+	fl.FlagLong(&ex.Out, "out", 'o', "File to write to (console only)")
+	fl.FlagLong(&help, "help", 'h', "This message")
+
+	for args := input; ; args = fl.Args() {
+		if err = fl.Getopt(args, nil); err != nil {
+			return nil, nil, "", err
+		} else if fl.NArgs() == 0 {
+			break
+		}
+		words = append(words, fl.Arg(0))
+	}
+
+	if help {
+		return nil, nil, Help(fl, "", "\nExample: archive --format csv --channel #general --after 2017-06-01"), nil
+	}
+
+	ex.Format = strings.ToLower(ex.Format)
+	if !strContains(archiveFormats, ex.Format) {
+		return nil, nil, "", fmt.Errorf("unknown format '%s', formats are: %s", ex.Format, strings.Join(archiveFormats, ", "))
+	}
+
+	if after != "" {
+		if ex.After, err = searchTime(after); err != nil {
+			return nil, nil, "", err
+		}
+	}
+	if before != "" {
+		if ex.Before, err = searchTime(before); err != nil {
+			return nil, nil, "", err
+		}
+	}
+	return ex, words, "", nil
+}
+
+// CoreArchive exports the guild's archived messages to a paste.
+func (dat *IOdata) CoreArchive() error {
+	// Return if the user does not have the role
+	if ok := dat.user.HasRoleType(dat.guildConfig, rolePermissionAdmin); !ok {
+		return ErrBadPermissions
+	}
+
+	ex, _, usage, err := archiveFlags(dat.io)
+	if err != nil {
+		return err
+	} else if usage != "" {
+		dat.output = usage
+		return nil
+	}
+	ex.GuildID = dat.guild.ID
+	ex.GuildName = dat.guild.Name
+	ex.Max = archivePasteMax
+
+	var buf bytes.Buffer
+	n, err := ex.Write(&buf)
+	if err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New("no messages found")
+	}
+
+	url, err := pasteIt(buf.String(), ex.Title())
+	if err != nil {
+		return err
+	}
+	dat.msgEmbed = embedCreator(fmt.Sprintf("Exported %d messages: %s", n, url), ColorGreen)
+	return nil
+}
+
+// Title describes what is exported.
+func (ex *archiveExport) Title() string {
+	title := ex.GuildName
+	if ex.Channel != "" {
+		title += " #" + strings.Trim(ex.Channel, "<#>")
+	}
+	if !ex.After.IsZero() {
+		title += " after " + ex.After.Format("2006-01-02")
+	}
+	if !ex.Before.IsZero() {
+		title += " before " + ex.Before.Format("2006-01-02")
+	}
+	return title
+}
+
+// each calls fn with the archived messages to export, oldest first. They are
+// read as they are needed, an archive can be too large to hold at once.
+func (ex *archiveExport) each(fn func(Message) error) error {
+	var q = bson.M{}
+	if ex.Channel != "" {
+		q["channelid"] = searchChannel(ex.GuildID, ex.Channel)
+	}
+
+	var span = bson.M{}
+	if !ex.After.IsZero() {
+		span["$gt"] = ex.After
+	}
+	if !ex.Before.IsZero() {
+		span["$lt"] = ex.Before
+	}
+	if len(span) > 0 {
+		q["timestamp"] = span
+	}
+
+	dbdat := DBdataCreate(ex.GuildID, CollectionMessages, Message{}, q, nil)
+	return dbdat.dbIter(Message{}, []string{"timestamp"}, func(d interface{}) error {
+		return fn(d.(Message))
+	})
+}
+
+// Write exports the messages in the chosen format, returning how many there
+// were. Stops with ErrArchiveTooLarge once more than Max bytes are written.
+func (ex *archiveExport) Write(w io.Writer) (int, error) {
+	cw := &archiveCounter{w: w}
+
+	var aw archiveWriter
+	switch ex.Format {
+	case archiveJSONL:
+		aw = &archiveJSONLWriter{enc: json.NewEncoder(cw)}
+	case archiveCSV:
+		aw = archiveCSVWriterNew(cw)
+	case archiveHTML:
+		aw = &archiveHTMLWriter{w: cw, ex: ex}
+	}
+
+	var n int
+	err := ex.each(func(m Message) error {
+		if ex.Max > 0 && cw.n > ex.Max {
+			return ErrArchiveTooLarge
+		}
+		if ex.files != "" {
+			ex.copyFiles(m)
+		}
+		n++
+		return aw.Message(m)
+	})
+	if err == nil {
+		err = aw.Close(n)
+	}
+	if err == nil && ex.Max > 0 && cw.n > ex.Max {
+		err = ErrArchiveTooLarge
+	}
+	return n, err
+}
+
+// WriteFile exports the messages to a file, named after the guild if not given.
+func (ex *archiveExport) WriteFile() (string, int, error) {
+	path := ex.Out
+	if path == "" {
+		path = fmt.Sprintf("%s-%s.%s", ex.GuildID, time.Now().Format("20060102-150405"), ex.Format)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Transcripts link to copies of the stored attachments next to them.
+	if ex.Format == archiveHTML {
+		ex.files = strings.TrimSuffix(path, filepath.Ext(path)) + "_files"
+	}
+
+	n, err := ex.Write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || n == 0 {
+		os.Remove(path)
+		if ex.files != "" {
+			os.RemoveAll(ex.files)
+		}
+	}
+	return path, n, err
+}
+
+// copyFiles copies the stored attachments of a message for a transcript.
+// Those that can't be copied are linked to Discord instead.
+func (ex *archiveExport) copyFiles(m Message) {
+	bs := &blobStore{GuildID: ex.GuildID}
+	for n, a := range m.Attachments {
+		if a.Hash == "" {
+			continue
+		}
+
+		err := os.MkdirAll(ex.files, 0755)
+		if err == nil {
+			err = bs.Copy(a.Hash, filepath.Join(ex.files, archiveFileName(a)))
+		}
+		if err != nil {
+			fmt.Printf("Copying attachment %s: %s\n", a.Filename, err)
+			m.Attachments[n].Hash = ""
+		}
+	}
+}
+
+// File is the link to an attachment in a transcript: the copy next to it if
+// it was stored, the dashboard's for pastes, otherwise Discord's.
+func (ex *archiveExport) File(a Attachment) string {
+	if a.Hash == "" {
+		return a.URL
+	} else if ex.files != "" {
+		return filepath.Base(ex.files) + "/" + archiveFileName(a)
+	} else if url := (&blobStore{GuildID: ex.GuildID}).URL(a.Hash); url != "" {
+		return url
+	}
+	return a.URL
+}
+
+// archiveFileName is the name of a copied attachment, its hash keeps the
+// names of files sent more than once apart.
+func archiveFileName(a Attachment) string {
+	return a.Hash + strings.ToLower(filepath.Ext(a.Filename))
+}
+
+// archiveRecordNew converts an archived message for exporting.
+func archiveRecordNew(m Message) ArchiveRecord {
+	rec := ArchiveRecord{
+		ID:            m.ID,
+		Time:          m.Timestamp,
+		ChannelID:     m.ChannelID,
+		ChannelName:   m.ChannelName,
+		UserID:        m.Author.ID,
+		Username:      m.Author.Name,
+		Discriminator: m.Author.Discriminator,
+		Content:       m.Content,
+		Previous:      m.EditedContent,
+		Attachments:   m.Attachments,
+	}
+	if !m.EditedTimestamp.IsZero() {
+		edited := m.EditedTimestamp
+		rec.Edited = &edited
+	}
+	if !m.Deleted.IsZero() {
+		deleted := m.Deleted
+		rec.Deleted = &deleted
+		rec.DeletedBy = m.DeletedBy.ID
+	}
+	return rec
+}
+
+// archiveWriter writes the messages of an export as they are read.
+type archiveWriter interface {
+	Message(m Message) error
+	Close(n int) error // Finishes an export of n messages.
+}
+
+// archiveCounter counts the bytes written through it.
+type archiveCounter struct {
+	w io.Writer
+	n int
+}
+
+func (c *archiveCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+// archiveJSONLWriter writes a message as JSON on each line.
+type archiveJSONLWriter struct {
+	enc *json.Encoder
+}
+
+func (aw *archiveJSONLWriter) Message(m Message) error {
+	return aw.enc.Encode(archiveRecordNew(m))
+}
+
+func (aw *archiveJSONLWriter) Close(n int) error {
+	return nil
+}
+
+// archiveCSVWriter writes a message on each row, earlier content and
+// attachments as JSON lists.
+type archiveCSVWriter struct {
+	cw *csv.Writer
+}
+
+func archiveCSVWriterNew(w io.Writer) *archiveCSVWriter {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"message_id", "time", "edited", "channel_id", "channel_name",
+		"user_id", "username", "discriminator", "content", "previous", "deleted", "deleted_by", "attachments"})
+	return &archiveCSVWriter{cw: cw}
+}
+
+func (aw *archiveCSVWriter) Message(m Message) error {
+	var edited, previous, deleted, attachments string
+	if !m.EditedTimestamp.IsZero() {
+		edited = m.EditedTimestamp.Format(time.RFC3339)
+	}
+	if !m.Deleted.IsZero() {
+		deleted = m.Deleted.Format(time.RFC3339)
+	}
+	if len(m.EditedContent) > 0 {
+		b, _ := json.Marshal(m.EditedContent)
+		previous = string(b)
+	}
+	if len(m.Attachments) > 0 {
+		b, _ := json.Marshal(m.Attachments)
+		attachments = string(b)
+	}
+
+	return aw.cw.Write([]string{m.ID, m.Timestamp.Format(time.RFC3339), edited, m.ChannelID, m.ChannelName,
+		m.Author.ID, m.Author.Name, m.Author.Discriminator, m.Content, previous, deleted, m.DeletedBy.ID, attachments})
+}
+
+func (aw *archiveCSVWriter) Close(n int) error {
+	aw.cw.Flush()
+	return aw.cw.Error()
+}
+
+// archiveHTMLWriter writes a transcript that can be browsed without the bot.
+type archiveHTMLWriter struct {
+	w       io.Writer
+	ex      *archiveExport
+	started bool
+}
+
+func (aw *archiveHTMLWriter) Message(m Message) error {
+	if !aw.started {
+		aw.started = true
+		err := archiveTemplate.ExecuteTemplate(aw.w, "head", map[string]interface{}{
+			"Title":     aw.ex.Title(),
+			"Generated": time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return archiveTemplate.ExecuteTemplate(aw.w, "message", map[string]interface{}{
+		"Export":  aw.ex,
+		"Message": m,
+	})
+}
+
+func (aw *archiveHTMLWriter) Close(n int) error {
+	if !aw.started {
+		return nil
+	}
+	return archiveTemplate.ExecuteTemplate(aw.w, "foot", n)
+}
+
+// archiveTemplate is the static HTML transcript of an export.
+var archiveTemplate = template.Must(template.New("archive").Funcs(template.FuncMap{
+	"link": messageLink,
+	"size": func(n int) string { return blobSize(int64(n)) },
+	"time": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04:05") },
+}).Parse(`{{define "head"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { background: #36393e; color: #dcddde; font-family: sans-serif; margin: 0 auto; max-width: 960px; padding: 1em; }
+h1 { font-size: 1.4em; } .info { color: #72767d; font-size: .85em; }
+.msg { border-bottom: 1px solid #40444b; padding: .5em 0; }
+.author { color: #fff; font-weight: bold; } .channel, .time, .edited { color: #72767d; font-size: .8em; }
+.content { white-space: pre-wrap; word-wrap: break-word; margin-top: .25em; }
+details { font-size: .85em; margin-top: .25em; } details li { color: #b9bbbe; white-space: pre-wrap; }
+.file { font-size: .85em; margin-top: .25em; } .file img { display: block; max-width: 400px; max-height: 300px; }
+a { color: #00b0f4; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="info">Exported {{time .Generated}} UTC. Times are UTC.</p>
+{{end}}{{define "message"}}{{$ex := .Export}}{{with .Message}}<div class="msg" id="{{.ID}}">
+<span class="author" title="{{.Author.ID}}">{{.Author.Name}}#{{.Author.Discriminator}}</span>
+<span class="channel">#{{.ChannelName}}</span>
+<a class="time" href="{{link $ex.GuildID .ChannelID .ID}}">{{time .Timestamp}}</a>
+{{if .EditedContent}}<span class="edited">(edited {{time .EditedTimestamp}})</span>{{end}}
+{{if not .Deleted.IsZero}}<span class="edited">(deleted {{time .Deleted}}{{if .DeletedBy.ID}} by {{.DeletedBy.Name}}{{end}})</span>{{end}}
+<div class="content">{{.Content}}</div>
+{{range .Attachments}}<div class="file">{{if .Width}}<a href="{{$ex.File .}}"><img src="{{$ex.File .}}" alt="{{.Filename}}"></a>{{end}}<a href="{{$ex.File .}}">{{.Filename}}</a> <span class="info">{{size .Size}}{{if not .Hash}}, not archived{{end}}</span></div>
+{{end}}{{if .EditedContent}}<details><summary>Edit history</summary><ol>{{range .EditedContent}}<li>{{.}}</li>{{end}}</ol></details>{{end}}
+</div>
+{{end}}{{end}}{{define "foot"}}<p class="info">{{.}} messages.</p>
+</body>
+</html>
+{{end}}`))
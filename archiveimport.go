@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// importWorkers is how many export files are imported at once.
+const importWorkers = 4
+
+// DiscordExport is the JSON written by common Discord chat exporters, such as
+// DiscordChatExporter. Only what the archive keeps is read.
+type DiscordExport struct {
+	Guild struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"guild"`
+	Channel struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Category string `json:"category"`
+	} `json:"channel"`
+	Messages []DiscordExportMessage `json:"messages"`
+}
+
+// DiscordExportMessage is a message of a chat export.
+type DiscordExportMessage struct {
+	ID              string     `json:"id"`
+	Type            string     `json:"type"`
+	Timestamp       time.Time  `json:"timestamp"`
+	TimestampEdited *time.Time `json:"timestampEdited"`
+	Content         string     `json:"content"`
+	Author          struct {
+		ID            string `json:"id"`
+		Name          string `json:"name"`
+		Discriminator string `json:"discriminator"`
+	} `json:"author"`
+	Attachments []struct {
+		ID       string `json:"id"`
+		URL      string `json:"url"`
+		FileName string `json:"fileName"`
+		Size     int    `json:"fileSizeBytes"`
+	} `json:"attachments"`
+}
+
+// ImportResult counts what happened to the messages of an export file.
+type ImportResult struct {
+	File     string
+	Guild    string
+	Channel  string
+	Added    int // New to the archive.
+	Existing int // Already archived, left alone.
+	Err      error
+}
+
+// archiveImport imports Discord chat exports into the archive. The path is a
+// file or a directory of them. Exports go to the guild they came from unless
+// another guild ID is given.
+func archiveImport(path, guildID string) ([]ImportResult, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files = []string{path}
+	if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*.json")); err != nil {
+			return nil, err
+		} else if len(files) == 0 {
+			return nil, errors.New("no .json files in " + path)
+		}
+	}
+
+	// Channels are independent of each other, several are imported at once.
+	var results = make([]ImportResult, len(files))
+	var wg sync.WaitGroup
+	var sem = make(chan struct{}, importWorkers)
+	for n, f := range files {
+		wg.Add(1)
+		go func(n int, f string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			results[n] = archiveImportFile(f, guildID)
+			<-sem
+		}(n, f)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// archiveImportFile imports the messages of a single export file.
+func archiveImportFile(path, guildID string) ImportResult {
+	var result = ImportResult{File: path}
+
+	f, err := os.Open(path)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer f.Close()
+
+	var export DiscordExport
+	if err = json.NewDecoder(f).Decode(&export); err != nil {
+		result.Err = fmt.Errorf("not a Discord export: %s", err)
+		return result
+	}
+
+	if guildID == "" {
+		guildID = export.Guild.ID
+	}
+	result.Guild = guildID
+	result.Channel = export.Channel.Name
+	if guildID == "" || export.Channel.ID == "" {
+		result.Err = errors.New("the export has no guild or channel, give the guild")
+		return result
+	}
+
+	// Exports of the same channel can overlap and be imported at once.
+	if err = messagesIndex(guildID); err != nil {
+		result.Err = fmt.Errorf("indexing message IDs: %s", err)
+		return result
+	}
+
+	for _, em := range export.Messages {
+		m := importMessage(export.Channel.ID, export.Channel.Name, em)
+		if m == nil {
+			continue
+		}
+
+		added, err := m.Update(guildID)
+		if err != nil {
+			result.Err = err
+			return result
+		} else if added {
+			result.Added++
+		} else {
+			result.Existing++
+		}
+	}
+	return result
+}
+
+// importMessage converts a message of an export to be archived, nil for
+// messages that aren't sent by users (such as pins and joins).
+func importMessage(channelID, channelName string, em DiscordExportMessage) *Message {
+	if em.ID == "" || (em.Type != "" && em.Type != "Default" && em.Type != "Reply") {
+		return nil
+	}
+
+	m := &Message{
+		ID:          em.ID,
+		ChannelID:   channelID,
+		ChannelName: channelName,
+		Content:     em.Content,
+		Timestamp:   em.Timestamp.UTC(),
+		Author: UserBasic{
+			ID:            em.Author.ID,
+			Name:          em.Author.Name,
+			Discriminator: em.Author.Discriminator,
+		},
+	}
+	if em.TimestampEdited != nil {
+		m.EditedTimestamp = em.TimestampEdited.UTC()
+	}
+	for _, a := range em.Attachments {
+		m.Attachments = append(m.Attachments, Attachment{ID: a.ID, Filename: a.FileName, URL: a.URL, Size: a.Size})
+	}
+	return m
+}
+
+// String summarises the import of a file.
+func (r ImportResult) String() string {
+	name := filepath.Base(r.File)
+	if r.Err != nil {
+		return fmt.Sprintf("%s: %s", name, r.Err)
+	}
+	return fmt.Sprintf("%s: #%s into %s, %d added, %d already archived",
+		name, strings.TrimPrefix(r.Channel, "#"), r.Guild, r.Added, r.Existing)
+}
+
+// messagesIndex makes archived message IDs unique. Archives from before the
+// index can have a message twice, all but the first copy are removed.
+func messagesIndex(guildID string) error {
+	dbdat := DBdataCreate(guildID, CollectionMessages, Message{}, nil, nil)
+	err := dbdat.dbIndex(messageIndex)
+	if !mgo.IsDup(err) {
+		return err
+	}
+
+	removed, err := dbdat.dbDedupe("id")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d duplicate archived messages of guild %s.\n", removed, guildID)
+	return dbdat.dbIndex(messageIndex)
+}
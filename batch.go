@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Variables of a batch script that set where chat commands are run.
+const (
+	batchGuild   = "GUILD"   // Guild chat commands are run in, required for them.
+	batchChannel = "CHANNEL" // Channel they are run in, the guild's main channel if unset.
+	batchUser    = "USER"    // User running them, the bot if unset.
+	batchPost    = "POST"    // "true" posts their output to the channel.
+)
+
+// batchInteractive are console commands that need someone at the console.
+var batchInteractive = map[string]bool{"watch": true, "kill": true, "info": true, "spawn": true, "exit": true}
+
+// BatchStep is the result of a line of a batch script.
+type BatchStep struct {
+	Line    int    `json:"line"`
+	Command string `json:"command"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Ignored bool   `json:"ignored,omitempty"` // The error did not stop the script.
+}
+
+// BatchResult is written as JSON once a batch script is done.
+type BatchResult struct {
+	Script string      `json:"script"`
+	OK     bool        `json:"ok"`
+	Error  string      `json:"error,omitempty"`
+	Steps  []BatchStep `json:"steps"`
+}
+
+// batch holds the variables of a running script.
+type batch struct {
+	config *Config
+	vars   map[string]string
+}
+
+// BatchExec runs a script of console and chat commands, writes the results as
+// JSON and exits; with a status of 1 if it was stopped by an error.
+//
+// Each line is a console command, or a chat command if it begins with the
+// prefix. Lines starting with '#' are comments. "set NAME value" sets a
+// variable used as $NAME or ${NAME}, environment variables are used if not set.
+// The script stops at the first error unless the line begins with '-'.
+func (cfg *Config) BatchExec(path string, stdout io.Writer) {
+	var result = BatchResult{Script: path, Steps: []BatchStep{}}
+
+	var err error
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		var f *os.File
+		if f, err = os.Open(path); err == nil {
+			defer f.Close()
+			r = f
+		}
+	}
+
+	// Chat commands need the guild configurations.
+	if err == nil {
+		err = cfg.GuildConfigLoad()
+	}
+
+	if err == nil {
+		b := &batch{config: cfg, vars: make(map[string]string)}
+		err = b.run(r, &result)
+	}
+
+	result.OK = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(result)
+
+	cfg.stop()
+	if !result.OK {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// run executes the script line by line, stopping at the first error not ignored.
+func (b *batch) run(r io.Reader, result *BatchResult) error {
+	scanner := bufio.NewScanner(r)
+	var n int
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var ignore bool
+		if strings.HasPrefix(line, "-") {
+			ignore = true
+			line = strings.TrimSpace(line[1:])
+		}
+
+		var step = BatchStep{Line: n, Command: line}
+		var err error
+		if line, err = b.expand(line); err == nil {
+			step.Command = line
+			step.Output, err = b.step(line)
+		}
+
+		if err != nil {
+			step.Error = err.Error()
+			step.Ignored = ignore
+		}
+		result.Steps = append(result.Steps, step)
+
+		if err != nil && !ignore {
+			return fmt.Errorf("line %d: %s", n, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// expand replaces the variables in a line. '$$' is a literal '$'.
+func (b *batch) expand(line string) (string, error) {
+	var missing []string
+	line = os.Expand(line, func(name string) string {
+		if name == "$" {
+			return "$"
+		} else if v, ok := b.vars[name]; ok {
+			return v
+		} else if v, ok := os.LookupEnv(name); ok {
+			return v
+		}
+		missing = append(missing, name)
+		return ""
+	})
+
+	if len(missing) > 0 {
+		return line, errors.New("undefined variable: " + strings.Join(missing, ", "))
+	}
+	return line, nil
+}
+
+// step runs a line of the script, returning what it printed.
+func (b *batch) step(line string) (string, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil
+	} else if strings.ToLower(fields[0]) == "set" {
+		if len(fields) < 2 {
+			return "", errors.New("usage: set NAME value")
+		}
+		value := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line[len(fields[0]):]), fields[1]))
+		b.vars[fields[1]] = strings.Trim(value, "\"")
+		return "", nil
+	}
+
+	chat, s := strToCommands(line, ConfigFile.Prefix)
+	if len(s) == 0 {
+		return "", nil
+	} else if chat {
+		return b.chat(strings.TrimPrefix(line, ConfigFile.Prefix))
+	} else if batchInteractive[strings.ToLower(s[0])] {
+		return "", errors.New("'" + s[0] + "' can only be used on the console")
+	} else if !consoleCommand(s[0]) {
+		return "", errors.New("unknown command: " + s[0])
+	}
+
+	con := console{config: b.config, input: s}
+	return stdoutCapture(con.Parser)
+}
+
+// chat runs a chat command as set by the script's variables.
+func (b *batch) chat(command string) (string, error) {
+	if b.vars[batchGuild] == "" {
+		return "", errors.New("set " + batchGuild + " before running chat commands")
+	}
+
+	con := console{config: b.config}
+	guild, err := con.guildFind(b.vars[batchGuild])
+	if err != nil {
+		return "", err
+	}
+
+	var channelID string
+	if b.vars[batchChannel] != "" {
+		channel, err := con.channelFind(guild.ID, b.vars[batchChannel])
+		if err != nil {
+			return "", err
+		}
+		channelID = channel.ID
+	}
+
+	dat, err := b.config.ioDataCreate(guild.ID, channelID, b.vars[batchUser], command)
+	if err != nil {
+		return "", err
+	} else if err = b.config.ioExec(dat, b.vars[batchPost] == "true"); err != nil {
+		return "", err
+	}
+
+	if dat.output == "" && dat.msgEmbed != nil {
+		return dat.msgEmbed.Description, nil
+	}
+	return dat.output, nil
+}
+
+// stdoutCapture runs a function, returning what it wrote to stdout.
+func stdoutCapture(fn func() error) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&buf, r)
+		close(done)
+	}()
+
+	stdout := os.Stdout
+	os.Stdout = w
+	err = fn()
+	os.Stdout = stdout
+
+	w.Close()
+	<-done
+	r.Close()
+	return strings.TrimRight(buf.String(), "\n"), err
+}
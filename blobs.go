@@ -0,0 +1,407 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Limits of a guild's blob store if it hasn't set them.
+const (
+	blobMaxDefault   = 8 << 20
+	blobQuotaDefault = 1 << 30
+)
+
+// Downloads of attachments run on a few workers, messages sent while the
+// queue is full have their attachments left as links.
+const (
+	blobWorkers  = 2
+	blobQueueMax = 256
+)
+
+// blobDirDefault is where blobs are stored if the configuration file doesn't say.
+const blobDirDefault = "blobs"
+
+// Errors of storing a file.
+var (
+	ErrBlobTooLarge = errors.New("file is larger than the guild allows")
+	ErrBlobQuota    = errors.New("guild's attachment quota is full")
+)
+
+// Blob is a file in a guild's blob store. Files are stored once by their
+// SHA-256, however many messages they were sent with.
+type Blob struct {
+	Hash        string
+	Size        int64
+	ContentType string
+	Added       time.Time
+}
+
+// blobStore keeps the attachments of a guild on disk.
+type blobStore struct {
+	GuildID string
+	Max     int64 // Largest file stored.
+	Quota   int64 // Space all of the guild's files can use.
+
+	client *http.Client
+	mu     *sync.Mutex
+}
+
+// blobStore gets the store of a guild, with its limits.
+func (cfg *Config) blobStore(gc *GuildConfig) *blobStore {
+	bs := &blobStore{
+		GuildID: gc.ID,
+		Max:     gc.AttachmentMax,
+		Quota:   gc.AttachmentQuota,
+		client:  http.DefaultClient,
+		mu:      &cfg.blobsMu,
+	}
+	if bs.Max <= 0 {
+		bs.Max = blobMaxDefault
+	}
+	if bs.Quota <= 0 {
+		bs.Quota = blobQuotaDefault
+	}
+
+	// Limits saved before the bot lowered its own are held to them.
+	maxLimit, quotaLimit := blobLimits()
+	bs.Max = blobMin(bs.Max, maxLimit)
+	bs.Quota = blobMin(bs.Quota, quotaLimit)
+	if cfg.Core != nil && cfg.Core.Session != nil && cfg.Core.Session.Client != nil {
+		bs.client = cfg.Core.Session.Client
+	}
+	return bs
+}
+
+// blobJob is a message waiting for its attachments to be stored.
+type blobJob struct {
+	store     *blobStore
+	messageID string
+	atts      []Attachment
+}
+
+// blobQueueAdd queues the attachments of an archived message to be stored,
+// starting the workers the first time.
+func (cfg *Config) blobQueueAdd(gc *GuildConfig, messageID string, atts []Attachment) {
+	cfg.blobQueueOnce.Do(func() {
+		cfg.blobQueue = make(chan blobJob, blobQueueMax)
+		for n := 0; n < blobWorkers; n++ {
+			go func() {
+				for job := range cfg.blobQueue {
+					job.store.Attachments(job.messageID, job.atts)
+				}
+			}()
+		}
+	})
+
+	select {
+	case cfg.blobQueue <- blobJob{store: cfg.blobStore(gc), messageID: messageID, atts: atts}:
+	default:
+		fmt.Println("Attachment queue is full, not storing those of message " + messageID)
+	}
+}
+
+// blobLimits are the largest file, and quota, in bytes the bot's operator lets
+// guilds set, so one guild can't fill the disk.
+func blobLimits() (int64, int64) {
+	var max, quota int64 = blobMaxDefault, blobQuotaDefault
+	if ConfigFile.AttachmentMaxLimit > 0 {
+		max = ConfigFile.AttachmentMaxLimit << 20
+	}
+	if ConfigFile.AttachmentQuotaLimit > 0 {
+		quota = ConfigFile.AttachmentQuotaLimit << 20
+	}
+	return max, quota
+}
+
+func blobMin(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// blobDir is the directory of every guild's blob store.
+func blobDir() string {
+	if ConfigFile.BlobDir != "" {
+		return ConfigFile.BlobDir
+	}
+	return blobDirDefault
+}
+
+// attachmentsNew converts the attachments of a message for archiving.
+func attachmentsNew(atts []*discordgo.MessageAttachment) []Attachment {
+	var list []Attachment
+	for _, a := range atts {
+		list = append(list, Attachment{
+			ID:       a.ID,
+			Filename: a.Filename,
+			URL:      a.URL,
+			Size:     a.Size,
+			Width:    a.Width,
+			Height:   a.Height,
+		})
+	}
+	return list
+}
+
+// Path is where a file is stored, split by the start of its hash to keep
+// directories small.
+func (bs *blobStore) Path(hash string) string {
+	return filepath.Join(blobDir(), dbSafe(bs.GuildID), hash[:2], hash)
+}
+
+// Attachments downloads the attachments of an archived message, then records
+// the hashes of those stored on the message. Files too large or over the quota
+// are left as links.
+func (bs *blobStore) Attachments(messageID string, atts []Attachment) {
+	var stored bool
+	for n := range atts {
+		if err := bs.Download(&atts[n]); err != nil {
+			fmt.Printf("Storing attachment %s: %s\n", atts[n].Filename, err)
+			continue
+		}
+		stored = true
+	}
+	if !stored {
+		return
+	}
+
+	q := bson.M{"id": messageID}
+	c := bson.M{"$set": bson.M{"attachments": atts}}
+	db := DBdataCreate(bs.GuildID, CollectionMessages, Message{}, q, c)
+	if err := db.dbEdit(Message{}); err != nil {
+		fmt.Println("Recording stored attachments: " + err.Error())
+	}
+}
+
+// Download stores an attachment, setting its hash.
+func (bs *blobStore) Download(a *Attachment) error {
+	if int64(a.Size) > bs.Max {
+		return ErrBlobTooLarge
+	}
+
+	resp, err := bs.client.Get(a.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("download failed: " + resp.Status)
+	}
+
+	a.Hash, err = bs.Put(resp.Body, resp.Header.Get("Content-Type"))
+	return err
+}
+
+// Put stores a file, returning its hash. A file already stored isn't stored
+// again and doesn't count towards the quota twice.
+func (bs *blobStore) Put(r io.Reader, contentType string) (string, error) {
+	dir := filepath.Join(blobDir(), dbSafe(bs.GuildID))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	// Written to a temporary file first, the hash is only known at the end.
+	tmp, err := ioutil.TempFile(dir, ".download-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(r, bs.Max+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	} else if size > bs.Max {
+		return "", ErrBlobTooLarge
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	path := bs.Path(hash)
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	q := bson.M{"hash": hash}
+	dbdat := DBdataCreate(bs.GuildID, CollectionBlobs, Blob{}, q, nil)
+	if err = dbdat.dbExists(); err == nil {
+		// Already stored, unless the file was removed by hand.
+		if _, err = os.Stat(path); err == nil {
+			return hash, nil
+		}
+		return hash, blobMove(tmp.Name(), path)
+	} else if err != ErrNoDocument {
+		return "", err
+	}
+
+	used, err := DBdataCreate(bs.GuildID, CollectionBlobs, Blob{}, nil, nil).dbSum("size")
+	if err != nil {
+		return "", err
+	} else if used+size > bs.Quota {
+		return "", ErrBlobQuota
+	}
+
+	if err = blobMove(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	blob := Blob{Hash: hash, Size: size, ContentType: contentType, Added: time.Now()}
+	if err = DBdataCreate(bs.GuildID, CollectionBlobs, blob, nil, nil).dbInsert(); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return hash, nil
+}
+
+// Get gets a stored file's record, for serving it.
+func (bs *blobStore) Get(hash string) (Blob, error) {
+	dbdat := DBdataCreate(bs.GuildID, CollectionBlobs, Blob{}, bson.M{"hash": hash}, nil)
+	if err := dbdat.dbGet(Blob{}); err != nil {
+		return Blob{}, err
+	}
+	return dbdat.Document.(Blob), nil
+}
+
+// URL links to a stored file on the dashboard, empty if the configuration
+// file doesn't say where the dashboard is reached.
+func (bs *blobStore) URL(hash string) string {
+	if ConfigFile.DashboardURL == "" || hash == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/api/guild/%s/files/%s", strings.TrimSuffix(ConfigFile.DashboardURL, "/"), bs.GuildID, hash)
+}
+
+// blobHash checks a hash is one files are stored by, so it is safe in a path.
+func blobHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// Usage is how many files the guild has stored, and the space they use.
+func (bs *blobStore) Usage() (int, int64, error) {
+	dbdat := DBdataCreate(bs.GuildID, CollectionBlobs, Blob{}, nil, nil)
+	count, err := dbdat.dbCount()
+	if err != nil {
+		return 0, 0, err
+	}
+	size, err := dbdat.dbSum("size")
+	return count, size, err
+}
+
+// Copy writes a copy of a stored file, for exports.
+func (bs *blobStore) Copy(hash, path string) error {
+	src, err := os.Open(bs.Path(hash))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// blobMove moves a downloaded file into its place in the store.
+func blobMove(tmp, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// blobSize is a size in bytes for people to read.
+func blobSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// CoreAttachments turns the storing of attachments on or off, sets its
+// limits, and shows the space used.
+func (conf *Config) CoreAttachments(dat *IOdata) error {
+	gc := dat.guildConfig
+	if len(dat.io) > 2 {
+		switch strings.ToLower(dat.io[2]) {
+		case "on", "enable":
+			gc.Attachments = true
+		case "off", "disable":
+			gc.Attachments = false
+		case "max", "quota":
+			if len(dat.io) < 4 {
+				return ErrBadArgs
+			}
+			mb, err := strconv.ParseFloat(dat.io[3], 64)
+			if err != nil || mb <= 0 {
+				return errors.New("give the size in MB")
+			}
+
+			size := int64(mb * (1 << 20))
+			maxLimit, quotaLimit := blobLimits()
+			if strings.ToLower(dat.io[2]) == "max" {
+				if size > maxLimit {
+					return fmt.Errorf("the bot allows files up to %s", blobSize(maxLimit))
+				}
+				gc.AttachmentMax = size
+			} else {
+				if size > quotaLimit {
+					return fmt.Errorf("the bot allows a quota up to %s", blobSize(quotaLimit))
+				}
+				gc.AttachmentQuota = size
+			}
+		default:
+			return ErrBadArgs
+		}
+
+		if err := conf.GuildConfigManager(gc); err != nil {
+			return err
+		}
+	}
+
+	bs := conf.blobStore(gc)
+	count, used, err := bs.Usage()
+	if err != nil {
+		return err
+	}
+
+	var state = "off"
+	if gc.Attachments {
+		state = "on"
+	}
+	dat.msgEmbed = embedCreator(fmt.Sprintf("Storing attachments is **%s**.\n"+
+		"Files up to %s, %d stored using %s of %s.",
+		state, blobSize(bs.Max), count, blobSize(used), blobSize(bs.Quota)), ColorGreen)
+	return nil
+}
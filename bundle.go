@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// Errors for guild configuration bundles.
+var (
+	ErrBundleNone     = errors.New("no import is waiting, attach a bundle to `admin import` first")
+	ErrBundleAttach   = errors.New("need to attach ONE exported .json bundle")
+	ErrBundleNotMatch = errors.New("bundle does not look like a SchiNET export")
+)
+
+// GuildBundle is a guild's configuration that can be exported and imported into another guild.
+type GuildBundle struct {
+	Version  string // Bot version that created the bundle.
+	Exported time.Time
+	Config   GuildConfig
+	Aliases  []Alias
+	Channels []ChannelInfo
+	Events   []Event
+	Commands []Command
+}
+
+// bundleChange is a single difference between a bundle and the guild it is imported into.
+type bundleChange struct {
+	section string
+	text    string
+	apply   func() error
+	refused error // Why it can't be imported, it is shown but not applied.
+}
+
+// bundlePreviewMax is the longest dry run shown in a message, longer ones are uploaded.
+const bundlePreviewMax = 1800
+
+// CoreBundle handles the export and import actions of the admin command.
+func (conf *Config) CoreBundle(dat *IOdata) error {
+	switch strings.ToLower(dat.io[1]) {
+	case "export":
+		bundle, err := conf.BundleExport(dat.guild.ID)
+		if err != nil {
+			return err
+		}
+
+		b, err := json.MarshalIndent(bundle, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		name := dbSafe(strings.ToLower(dat.guild.Name)) + "-config.json"
+		if _, err = dat.session.ChannelFileSend(dat.msg.ChannelID, name, bytes.NewReader(b)); err != nil {
+			return err
+		}
+		return nil
+	case "import":
+		var action string
+		if len(dat.io) > 2 {
+			action = strings.ToLower(dat.io[2])
+		}
+
+		switch action {
+		case "confirm", "apply":
+			return conf.bundleApply(dat)
+		case "cancel":
+			conf.importsMu.Lock()
+			delete(conf.imports, dat.guild.ID)
+			conf.importsMu.Unlock()
+			dat.msgEmbed = embedCreator("Import cancelled.", ColorMaroon)
+			return nil
+		}
+		return conf.bundleLoad(dat)
+	}
+	return ErrBadArgs
+}
+
+// BundleExport collects a guild's configuration into a bundle.
+func (conf *Config) BundleExport(guildID string) (*GuildBundle, error) {
+	var bundle = &GuildBundle{Version: _version, Exported: time.Now()}
+
+	gc := conf.GuildConfigByID(guildID)
+	if gc == nil {
+		return nil, errors.New("guild configuration is not loaded")
+	}
+	bundle.Config = *gc
+
+	alias := &Alias{ServerID: guildID}
+	aliases, err := alias.GetAll()
+	if err != nil && err != ErrNoAliases {
+		return nil, err
+	}
+	bundle.Aliases = aliases
+
+	// Channel names are what is matched when imported, fill in any missing.
+	dbdat := DBdataCreate(guildID, CollectionChannels, ChannelInfo{}, nil, nil)
+	if err := dbdat.dbGetAll(ChannelInfo{}); err != nil {
+		return nil, err
+	}
+	for _, d := range dbdat.Documents {
+		ch := d.(ChannelInfo)
+		for _, c := range conf.Core.Links[guildID] {
+			if c.ID == ch.ID {
+				ch.Name = c.Name
+				break
+			}
+		}
+		if ch.Name != "" {
+			bundle.Channels = append(bundle.Channels, ch)
+		}
+	}
+
+	dbdat = DBdataCreate(guildID, CollectionEvents, Event{}, nil, nil)
+	if err := dbdat.dbGetAll(Event{}); err != nil {
+		return nil, err
+	}
+	for _, d := range dbdat.Documents {
+		bundle.Events = append(bundle.Events, d.(Event))
+	}
+
+	dbdat = DBdataCreate(guildID, CollectionCommands, Command{}, nil, nil)
+	if err := dbdat.dbGetAll(Command{}); err != nil {
+		return nil, err
+	}
+	for _, d := range dbdat.Documents {
+		bundle.Commands = append(bundle.Commands, d.(Command))
+	}
+
+	return bundle, nil
+}
+
+// bundleLoad reads an attached bundle and shows what importing it would change.
+func (conf *Config) bundleLoad(dat *IOdata) error {
+	if dat.msg == nil || len(dat.msg.Attachments) != 1 {
+		return ErrBundleAttach
+	} else if !strings.HasSuffix(dat.msg.Attachments[0].Filename, ".json") {
+		return ErrBundleAttach
+	}
+
+	attach := dat.msg.Attachments[0]
+	txt, err := getFile(attach.Filename, attach.URL)
+	if err != nil {
+		return err
+	}
+
+	var bundle GuildBundle
+	if err = json.Unmarshal([]byte(txt), &bundle); err != nil {
+		return fmt.Errorf("reading bundle: %s", err.Error())
+	} else if bundle.Version == "" || bundle.Config.ID == "" {
+		return ErrBundleNotMatch
+	}
+
+	changes, err := conf.BundleDiff(dat.guild.ID, &bundle)
+	if err != nil {
+		return err
+	}
+
+	conf.importsMu.Lock()
+	if conf.imports == nil {
+		conf.imports = make(map[string]*GuildBundle)
+	}
+	conf.imports[dat.guild.ID] = &bundle
+	conf.importsMu.Unlock()
+
+	var diff string
+	if len(changes) == 0 {
+		diff += "  Nothing would change.\n"
+	}
+	for _, c := range changes {
+		if c.refused != nil {
+			diff += fmt.Sprintf("- [%s] %s (refused: %s)\n", c.section, c.text, c.refused.Error())
+			continue
+		}
+		diff += fmt.Sprintf("+ [%s] %s\n", c.section, c.text)
+	}
+
+	var msg = fmt.Sprintf("Dry run of importing **%s** (exported %s):\n",
+		bundle.Config.Name, bundle.Exported.Format(time.UnixDate))
+	if len(diff) > bundlePreviewMax {
+		// Too long for a message, the changes are attached instead.
+		name := dbSafe(strings.ToLower(bundle.Config.Name)) + "-import.diff"
+		if _, err = dat.session.ChannelFileSend(dat.msg.ChannelID, name, strings.NewReader(diff)); err != nil {
+			return err
+		}
+		msg += fmt.Sprintf("%d changes, attached as **%s**.\n", len(changes), name)
+	} else {
+		msg += "```diff\n" + diff + "```"
+	}
+	msg += "Existing settings not in the bundle are kept. Roles are not imported.\n" +
+		"Use `admin import confirm` to apply or `admin import cancel` to discard."
+
+	dat.output = msg
+	return nil
+}
+
+// bundleApply imports the bundle waiting for the guild.
+func (conf *Config) bundleApply(dat *IOdata) error {
+	conf.importsMu.Lock()
+	bundle, ok := conf.imports[dat.guild.ID]
+	delete(conf.imports, dat.guild.ID)
+	conf.importsMu.Unlock()
+
+	if !ok {
+		return ErrBundleNone
+	}
+
+	// Diff again, the guild may have changed since the dry run.
+	changes, err := conf.BundleDiff(dat.guild.ID, bundle)
+	if err != nil {
+		return err
+	}
+
+	var applied, refused int
+	for _, c := range changes {
+		if c.refused != nil {
+			refused++
+			continue
+		}
+		if err := c.apply(); err != nil {
+			return fmt.Errorf("import stopped after %d of %d changes: %s", applied, len(changes)-refused, err.Error())
+		}
+		applied++
+	}
+
+	msg := fmt.Sprintf("%s imported **%d** changes from **%s**.", dat.user.StringPretty(), applied, bundle.Config.Name)
+	if refused > 0 {
+		msg += fmt.Sprintf(" %d were refused.", refused)
+	}
+	dat.msgEmbed = embedCreator(msg, ColorGreen)
+	return nil
+}
+
+// BundleDiff compares a bundle to a guild and returns the changes importing would make.
+func (conf *Config) BundleDiff(guildID string, bundle *GuildBundle) ([]bundleChange, error) {
+	var changes []bundleChange
+
+	gc := conf.GuildConfigByID(guildID)
+	if gc == nil {
+		return nil, errors.New("guild configuration is not loaded")
+	}
+
+	// Prefix, roles are specific to each guild and are left alone.
+	if p := bundle.Config.Prefix; p != "" && p != gc.Prefix {
+		changes = append(changes, bundleChange{
+			section: "prefix",
+			text:    fmt.Sprintf("%s -> %s", gc.Prefix, p),
+			apply: func() error {
+				gc.Prefix = p
+				return conf.GuildConfigManager(gc)
+			},
+		})
+	}
+
+	for _, a := range bundle.Aliases {
+		a := a
+		current := &Alias{Caller: a.Caller, ServerID: guildID}
+		if err := current.Get(); err != nil && err != mgo.ErrNotFound {
+			return nil, err
+		} else if err == nil && current.Linked == a.Linked && current.Disabled == a.Disabled {
+			continue
+		}
+
+		text := fmt.Sprintf("%s -> %s", a.Caller, a.Linked)
+		if a.Disabled {
+			text = fmt.Sprintf("%s (disabled)", a.Caller)
+		}
+		_, refused := bundleAlias(guildID, a)
+		changes = append(changes, bundleChange{
+			section: "alias",
+			text:    text,
+			refused: refused,
+			apply: func() error {
+				// Checked again, aliases imported before it can form a loop.
+				alias, err := bundleAlias(guildID, a)
+				if err != nil {
+					return err
+				}
+				return alias.Update()
+			},
+		})
+	}
+
+	for _, ch := range bundle.Channels {
+		ch := ch
+		var channelID string
+		for _, c := range conf.Core.Links[guildID] {
+			if c.Name == ch.Name && c.Type == 0 {
+				channelID = c.ID
+				break
+			}
+		}
+		if channelID == "" {
+			continue
+		}
+
+		current := ChannelNew(channelID, guildID)
+		if current.Check() == ch.Enabled {
+			continue
+		}
+
+		state := "disabled"
+		if ch.Enabled {
+			state = "enabled"
+		}
+		changes = append(changes, bundleChange{
+			section: "channel",
+			text:    fmt.Sprintf("#%s commands %s", ch.Name, state),
+			apply: func() error {
+				info := ChannelInfo{ID: channelID, Name: ch.Name, Server: guildID, Enabled: ch.Enabled}
+				return info.Update()
+			},
+		})
+	}
+
+	dbdat := DBdataCreate(guildID, CollectionEvents, Event{}, nil, nil)
+	if err := dbdat.dbGetAll(Event{}); err != nil {
+		return nil, err
+	}
+	for _, e := range bundle.Events {
+		e := e
+		var exists bool
+		for _, d := range dbdat.Documents {
+			ev := d.(Event)
+			if ev.Day == e.Day && ev.HHMM == e.HHMM && ev.Description == e.Description {
+				exists = true
+				break
+			}
+		}
+		if exists {
+			continue
+		}
+
+		changes = append(changes, bundleChange{
+			section: "event",
+			text:    fmt.Sprintf("%s %s - %s", e.Day, e.HHMM, e.Description),
+			apply: func() error {
+				ev := e
+				ev.ID = ""
+				ev.ServerID = guildID
+				// Reschedule to the next occurence for this guild.
+				if ts, err := evTime(ev.Day, ev.HHMM); err == nil {
+					ev.Time = ts
+				}
+				_, err := ev.Add()
+				return err
+			},
+		})
+	}
+
+	for _, c := range bundle.Commands {
+		c := c
+		current := &Command{Name: c.Name, ServerID: guildID}
+		if err := current.Get(); err != nil && err != ErrCommandNotFound {
+			return nil, err
+		} else if err == nil && current.Response == c.Response && current.Color == c.Color && current.Permission == c.Permission {
+			continue
+		}
+
+		cmd, refused := bundleCommand(guildID, c)
+		change := bundleChange{
+			section: "command",
+			text:    fmt.Sprintf("%s -> %s", c.Name, c.Response),
+			refused: refused,
+		}
+		if refused == nil {
+			change.apply = cmd.Update
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// bundleAlias makes an alias of a bundle for the guild, checked as if it
+// were added with the alias command.
+func bundleAlias(guildID string, a Alias) (*Alias, error) {
+	alias := &Alias{
+		Caller:       a.Caller,
+		Linked:       a.Linked,
+		ServerID:     guildID,
+		Disabled:     a.Disabled,
+		AddedBy:      a.AddedBy,
+		Placeholders: a.Placeholders,
+	}
+
+	if alias.Caller == "" {
+		return nil, errors.New("bad alias name")
+	} else if alias.Disabled {
+		alias.Linked = ""
+		return alias, nil
+	} else if alias.Linked == "" {
+		return nil, errors.New("bad original command")
+	}
+
+	if alias.Placeholders {
+		if err := alias.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := alias.Chain(); err != nil {
+		return nil, err
+	}
+	return alias, nil
+}
+
+// bundleCommand makes a custom command of a bundle for the guild, checked as
+// if it were added with the cmd command.
+func bundleCommand(guildID string, c Command) (*Command, error) {
+	cmd := c
+	cmd.ID = ""
+	cmd.Name = strings.ToLower(cmd.Name)
+	cmd.ServerID = guildID
+	// Uses are counted by each guild.
+	cmd.Count = 0
+	// Channel restrictions are IDs from the other guild.
+	cmd.Channels = nil
+
+	if err := cmd.Validate(); err != nil {
+		return nil, err
+	}
+	return &cmd, nil
+}
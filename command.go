@@ -0,0 +1,422 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pborman/getopt/v2"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Error constants for custom commands.
+var (
+	ErrCommandNotFound = errors.New("custom command not found")
+	ErrCommandReserved = errors.New("name is used by a built-in command")
+	ErrCommandChannel  = errors.New("that command can't be used in this channel")
+)
+
+// Constants for producing helpful text for custom command operations.
+const (
+	commandSyntaxAdd    = ",cmd   --add   -n hello   -o \"Hello {user}!\"\n"
+	commandSyntaxEdit   = ",cmd   --edit   -n hello   --color 3B8040   --permission mod\n"
+	commandSyntaxDel    = ",cmd   --remove   -n hello\n"
+	commandSyntaxList   = ",cmd   --list\n"
+	commandSyntaxFields = "\nVariables:\n  {user} {username} {channel} {args} {count} {random:a|b|c}\n" +
+		"\nUse 'none' with --color or --permission, or 'all' with --channel, to clear it.\n"
+	commandSyntaxAll = "\n\n" + commandSyntaxAdd + commandSyntaxEdit + commandSyntaxDel + commandSyntaxList + commandSyntaxFields
+)
+
+// commandResponseMax is the longest response, a Discord message's limit.
+const commandResponseMax = 2000
+
+// commandReserved are built-in commands that custom commands can't replace.
+var commandReserved = []string{
+	"help", "roll", "top10", "gen", "sz", "invite", "ally", "user", "alias", "histo",
+	"event", "events", "ticket", "tickets", "cmd", "command", "script", "scripts",
+	"clear", "delete", "clear-slow", "vote", "admin", "contributions", "contributors",
+	"donators", "contribute", "thanks", "ty", "echo", "search", "archive", "deleted",
+}
+
+// CoreDatabase will control adding and removing user defined commands.
+func (dat *IOdata) CoreDatabase() error {
+	var help, list, add, edit, remove bool
+	var name, response, color, perm string
+	var channels []string
+
+	fl := getopt.New()
+
+	fl.FlagLong(&add, "add", 'a', "Add a command")
+	fl.FlagLong(&edit, "edit", 'e', "Edit a command")
+	fl.FlagLong(&remove, "remove", 'r', "Remove a command")
+	fl.FlagLong(&list, "list", 'l', "List all commands")
+	fl.FlagLong(&help, "help", 'h', "This message")
+	fl.FlagLong(&name, "name", 'n', "Name of the command")
+	fl.FlagLong(&response, "response", 'o', "Response sent, can contain variables")
+	fl.FlagLong(&color, "color", 'c', "Embed color in hex, plain text if not set")
+	fl.FlagLong(&perm, "permission", 'p', "Role needed to use: mod or admin")
+	fl.FlagLong(&channels, "channel", 0, "Channels it can be used in, comma separated")
+
+	if err := fl.Getopt(dat.io, nil); err != nil {
+		return err
+	}
+	if fl.NArgs() > 0 {
+		if err := fl.Getopt(fl.Args(), nil); err != nil {
+			return err
+		}
+	}
+
+	if list {
+		var err error
+		dat.output, err = commandList(dat.guild.ID)
+		return err
+	} else if help || !(add || edit || remove) {
+		dat.output = Help(fl, "", commandSyntaxAll)
+		return nil
+	}
+
+	// Return if the user does not have the role
+	if ok := dat.user.HasRoleType(dat.guildConfig, rolePermissionMod); !ok {
+		return ErrBadPermissions
+	}
+
+	name = strings.ToLower(name)
+	if name == "" {
+		return errors.New("need to supply a command name ('--name')")
+	}
+
+	cmd := CommandNew(dat.guild.ID, name, response, dat.user)
+	if remove {
+		if err := cmd.Delete(); err != nil {
+			return err
+		}
+		msg := fmt.Sprintf("%s removed the **%s** command.", dat.user.StringPretty(), name)
+		dat.msgEmbed = embedCreator(msg, ColorMaroon)
+		return nil
+	}
+
+	if add {
+		if err := cmd.Get(); err == nil {
+			return errors.New("command already exists, use '--edit' to change it")
+		} else if err != ErrCommandNotFound {
+			return err
+		}
+		if response == "" {
+			return errors.New("need to supply a response ('--response')")
+		}
+	} else if edit {
+		if err := cmd.Get(); err != nil {
+			return err
+		}
+		if response != "" {
+			cmd.Response = response
+		}
+	}
+
+	// Optional settings, 'none' and 'all' clear the setting.
+	switch strings.ToLower(color) {
+	case "":
+	case "none":
+		cmd.Color = 0
+	default:
+		c, err := strconv.ParseInt(strings.TrimPrefix(color, "#"), 16, 32)
+		if err != nil || c < 0 || c > 0xFFFFFF {
+			return errors.New("bad color, use hex such as: 3B8040")
+		}
+		cmd.Color = int(c)
+	}
+
+	switch strings.ToLower(perm) {
+	case "":
+	case "none", "everyone":
+		cmd.Permission = ""
+	case "mod", "moderator":
+		cmd.Permission = "mod"
+	case "admin", "administrator":
+		cmd.Permission = "admin"
+	default:
+		return errors.New("bad permission, use: mod, admin, or none")
+	}
+
+	if len(channels) == 1 && strings.ToLower(channels[0]) == "all" {
+		cmd.Channels = nil
+	} else if len(channels) > 0 {
+		cmd.Channels = nil
+		for _, ch := range channels {
+			if id := channelIDClean(ch); id != "" {
+				cmd.Channels = append(cmd.Channels, id)
+			}
+		}
+	}
+
+	if err := cmd.Validate(); err != nil {
+		return err
+	} else if err := cmd.Update(); err != nil {
+		return err
+	}
+
+	var action = "added"
+	if edit {
+		action = "edited"
+	}
+	msg := fmt.Sprintf("%s %s the **%s** command.", dat.user.StringPretty(), action, name)
+	dat.msgEmbed = embedCreator(msg, ColorGreen)
+	return nil
+}
+
+// CommandNew creates a new custom command object.
+func CommandNew(serverID, name, response string, user *User) *Command {
+	return &Command{
+		Name:      name,
+		Response:  response,
+		ServerID:  serverID,
+		AddedBy:   user.Basic(),
+		DateAdded: time.Now(),
+	}
+}
+
+// Validate checks that a command can be saved.
+func (cmd *Command) Validate() error {
+	if cmd.Name == "" {
+		return errors.New("need to supply a command name ('--name')")
+	}
+	for _, r := range commandReserved {
+		if r == cmd.Name {
+			return ErrCommandReserved
+		}
+	}
+
+	if cmd.Response == "" {
+		return errors.New("need to supply a response ('--response')")
+	} else if len(cmd.Response) > commandResponseMax {
+		return fmt.Errorf("response is too long, %d characters max", commandResponseMax)
+	}
+
+	if cmd.Color < 0 || cmd.Color > 0xFFFFFF {
+		return errors.New("bad color, use hex such as: 3B8040")
+	}
+	switch cmd.Permission {
+	case "", "mod", "admin":
+	default:
+		return errors.New("bad permission, use: mod, admin, or none")
+	}
+	return nil
+}
+
+// CommandRun processes a custom command if no built-in command matched.
+func (dat *IOdata) CommandRun() error {
+	cmd := CommandNew(dat.guild.ID, strings.ToLower(dat.io[0]), "", dat.user)
+	if err := cmd.Get(); err != nil {
+		if err == ErrCommandNotFound {
+			// Not a custom command, nothing to do.
+			return nil
+		}
+		return err
+	}
+
+	switch cmd.Permission {
+	case "mod":
+		if !dat.user.HasRoleType(dat.guildConfig, rolePermissionMod) && !dat.user.HasRoleType(dat.guildConfig, rolePermissionAdmin) {
+			return ErrBadPermissions
+		}
+	case "admin":
+		if !dat.user.HasRoleType(dat.guildConfig, rolePermissionAdmin) {
+			return ErrBadPermissions
+		}
+	}
+
+	if len(cmd.Channels) > 0 {
+		var allowed bool
+		for _, ch := range cmd.Channels {
+			if dat.msg != nil && ch == dat.msg.ChannelID {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return ErrCommandChannel
+		}
+	}
+
+	if err := cmd.Used(); err != nil {
+		return err
+	}
+
+	response := cmd.Render(dat)
+	if cmd.Color != 0 {
+		dat.msgEmbed = embedCreator(response, cmd.Color)
+		return nil
+	}
+	dat.output = response
+	return nil
+}
+
+// Render fills in the variables of the command's response.
+func (cmd *Command) Render(dat *IOdata) string {
+	var out string
+	text := cmd.Response
+
+	for {
+		start := strings.IndexByte(text, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		out += text[:start]
+		field := text[start+1 : end]
+		text = text[end+1:]
+
+		var arg string
+		if n := strings.IndexByte(field, ':'); n >= 0 {
+			field, arg = field[:n], field[n+1:]
+		}
+
+		switch strings.ToLower(field) {
+		case "user":
+			out += "<@" + dat.user.ID + ">"
+		case "username":
+			out += dat.user.Username
+		case "channel":
+			if dat.msg != nil {
+				out += "<#" + dat.msg.ChannelID + ">"
+			}
+		case "args":
+			out += strings.Join(dat.io[1:], " ")
+		case "count":
+			out += strconv.Itoa(cmd.Count)
+		case "random":
+			choices := strings.Split(arg, "|")
+			r := rand.New(rand.NewSource(time.Now().UnixNano()))
+			out += choices[r.Intn(len(choices))]
+		default:
+			// Unknown variable, leave it as it was typed.
+			out += "{" + field
+			if arg != "" {
+				out += ":" + arg
+			}
+			out += "}"
+		}
+	}
+
+	return out + text
+}
+
+// Get a custom command from the database.
+func (cmd *Command) Get() error {
+	var q = make(map[string]interface{})
+	q["name"] = cmd.Name
+
+	dbdat := DBdataCreate(cmd.ServerID, CollectionCommands, Command{}, q, nil)
+	if err := dbdat.dbGet(Command{}); err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrCommandNotFound
+		}
+		return err
+	}
+
+	var command = Command{}
+	command = dbdat.Document.(Command)
+	*cmd = command
+
+	return nil
+}
+
+// Update a custom command in the database.
+func (cmd *Command) Update() error {
+	var q = make(map[string]interface{})
+	var c = make(map[string]interface{})
+
+	q["name"] = cmd.Name
+	c["$set"] = bson.M{
+		"response":   cmd.Response,
+		"color":      cmd.Color,
+		"permission": cmd.Permission,
+		"channels":   cmd.Channels,
+	}
+
+	dbdat := DBdataCreate(cmd.ServerID, CollectionCommands, cmd, q, c)
+	err := dbdat.dbEdit(Command{})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			// Add to DB since it doesn't exist.
+			return dbdat.dbInsert()
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Used increments the amount of times a command has been called.
+func (cmd *Command) Used() error {
+	var q = make(map[string]interface{})
+	var c = make(map[string]interface{})
+
+	q["name"] = cmd.Name
+	c["$inc"] = bson.M{"count": 1}
+
+	dbdat := DBdataCreate(cmd.ServerID, CollectionCommands, cmd, q, c)
+	if err := dbdat.dbEdit(Command{}); err != nil {
+		return err
+	}
+
+	cmd.Count++
+	return nil
+}
+
+// Delete a custom command from the database.
+func (cmd *Command) Delete() error {
+	if err := cmd.Get(); err != nil {
+		return err
+	}
+
+	dbdat := DBdataCreate(cmd.ServerID, CollectionCommands, cmd, nil, nil)
+	return dbdat.dbDeleteID(cmd.ID)
+}
+
+// commandList prints all custom commands for a guild.
+func commandList(serverID string) (string, error) {
+	dbdat := DBdataCreate(serverID, CollectionCommands, Command{}, nil, nil)
+	if err := dbdat.dbGetAll(Command{}); err != nil {
+		return "", err
+	}
+
+	if len(dbdat.Documents) == 0 {
+		return "", errors.New("no custom commands found")
+	}
+
+	var msg = "Custom commands:\n\nFormat: [Name]  [Uses]  [Response]\n"
+	var cmd Command
+	for _, d := range dbdat.Documents {
+		cmd = d.(Command)
+		response := cmd.Response
+		if len(response) > 37 {
+			response = response[0:37] + "..."
+		}
+
+		var limits string
+		if cmd.Permission != "" {
+			limits += " (" + cmd.Permission + ")"
+		}
+		if len(cmd.Channels) > 0 {
+			limits += fmt.Sprintf(" (%d channels)", len(cmd.Channels))
+		}
+		msg += fmt.Sprintf("  %s [%d]%s -> %s\n", cmd.Name, cmd.Count, limits, response)
+	}
+	return "```" + msg + "```", nil
+}
+
+// Attempts to return an ID of a channel despite <#ID> or plain ID format.
+func channelIDClean(str string) string {
+	return strings.Trim(str, "<#> ")
+}
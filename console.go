@@ -1,19 +1,22 @@
 package main
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"net"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/chzyer/readline"
 )
 
+// watchBuffer is how many messages a watcher holds before dropping them.
+const watchBuffer = 100
+
 // Hold console information
 type console struct {
 	config *Config
@@ -22,20 +25,30 @@ type console struct {
 
 func (cfg *Config) core() {
 	var err error
-	reader := bufio.NewReader(os.Stdin)
 	cmdPrefix := ConfigFile.Prefix
 
+	if cfg.line, err = cfg.lineNew(); err != nil {
+		fmt.Println(err)
+		cfg.cleanup()
+		return
+	}
+
 	for {
-		fmt.Printf("[%s] > ", time.Now().Format(time.Stamp))
-		input, _ := reader.ReadString('\n')
-		_, s := strToCommands(input, cmdPrefix)
-		iodat := sliceToIOdata(cfg.Core, s, cmdPrefix)
+		cfg.line.SetPrompt(fmt.Sprintf("[%s] > ", time.Now().Format(time.Stamp)))
+		input, err := cfg.line.Readline()
+		if err == readline.ErrInterrupt {
+			continue
+		} else if err != nil {
+			// End of input, such as Ctrl+D, is the same as "exit".
+			break
+		}
 
-		if len(iodat.io) > 0 {
-			if iodat.io[0] == "exit" {
+		_, s := strToCommands(input, cmdPrefix)
+		if len(s) > 0 {
+			if s[0] == "exit" {
 				break
 			} else {
-				con := console{config: cfg, input: iodat.io}
+				con := console{config: cfg, input: s}
 				if err = con.Parser(); err != nil {
 					fmt.Println(err)
 					continue
@@ -45,6 +58,7 @@ func (cfg *Config) core() {
 	}
 
 	// Cleanup here from "exit"
+	cfg.line.Close()
 	cfg.cleanup()
 }
 
@@ -91,6 +105,48 @@ func (con *console) Parser() error {
 	case "kill":
 		return con.WatchKill()
 
+	// Manage the global aliases shared by all guilds.
+	case "alias":
+		return con.Alias()
+
+	// List the guilds, or a guild's channels and members.
+	case "guilds":
+		return con.Guilds()
+	case "channels":
+		return con.Channels()
+	case "members":
+		return con.Members()
+
+	// Post a message or an embed to a channel.
+	case "send":
+		return con.Send(false)
+	case "embed":
+		return con.Send(true)
+
+	// Run a chat command as a user of a guild.
+	case "run":
+		return con.Run()
+
+	// Grant or revoke the bot's roles.
+	case "grant":
+		return con.Role(true)
+	case "revoke":
+		return con.Role(false)
+
+	// Reload the guild configurations from the database.
+	case "reload":
+		return con.Reload()
+
+	// Export a guild's archived messages, or import them from Discord exports.
+	case "archive":
+		return con.Archive()
+	case "import":
+		return con.Import()
+
+	// Display a guild's statistics.
+	case "stats":
+		return con.Stats()
+
 	case "help":
 		fallthrough
 	default:
@@ -100,14 +156,15 @@ func (con *console) Parser() error {
 	return nil
 }
 
-// Spawner launches a new command prompt to perform the command in.
+// Spawner performs the command in the background, leaving the console free.
 func (con *console) Spawner(input []string) error {
-	// Launch a new window (WINDOWS SPECIFIC- NEED CHANGING.)
-	// TAG: TODO - *nix compatible.
-	cmd := exec.Command("cmd", "/C", "start", "SchiNET.exe", "-exec", "\""+strings.Join(input, " ")+"\"")
-
-	err := cmd.Start()
-	return err
+	spawned := console{config: con.config, input: input}
+	go func() {
+		if err := spawned.Parser(); err != nil {
+			fmt.Println(err)
+		}
+	}()
+	return nil
 }
 
 // OneTimeExec a series of commands then promptly exit.
@@ -153,127 +210,130 @@ func (con *console) Reset(item string) error {
 	return errors.New("unknown thing to reset")
 }
 
-// Watch -es a Guild and a Channel (if specified). It will launch a new window
-// with output from what is selected.
+// Watch -es a Guild and a Channel (if specified). Output is streamed into this
+// terminal, or served on a TCP port or Unix socket for a '-watcher' client.
 func (con *console) Watch() error {
 
 	var guilds = con.config.Core.Guilds
 	// List available guilds.
-	fmt.Println("Select a guild by number: ")
+	var names = []string{"Private Messages"}
+	fmt.Println("Select a guild by number or name: ")
 	fmt.Printf(" [%2d] %s\n", 0, "Private Messages")
 	for n, g := range guilds {
 		fmt.Printf(" [%2d] %s\n", n+1, g.Name)
+		names = append(names, g.Name)
 	}
 
-	var num = -1
-	var input string
-	var err error
-	reader := bufio.NewReader(os.Stdin)
-
-	// Run until either ",quit" or a valid option is selected.
-	for num < 0 {
-		fmt.Print("Guild number [type 'exit' to exit]: ")
-		input, _ = reader.ReadString('\n')
-		input = stripWhiteSpace(input)
-		num, err = strconv.Atoi(input)
-		if strings.ToLower(input) == "exit" {
-			return nil
-		} else if err != nil {
-			num = -1
-			continue
-		} else if num >= 0 && num <= len(guilds) {
-			break
-		}
+	// Run until either "exit" or a valid option is selected.
+	num, err := con.pick("Guild [type 'exit' to exit]: ", names, 0)
+	if err != nil || num < 0 {
+		return err
 	}
 
-	var watched WatchLog
+	var watched = &WatchLog{}
 	if num == 0 {
 		watched.guildID = "private"
 		watched.guildName = "private"
+		watched.channelAll = true
 	} else {
-
 		watched.guildID = guilds[num-1].ID
 		watched.guildName = guilds[num-1].Name
-		// Reset num (for channel check.)
-		num = -1
-	}
-
-	var channels []*discordgo.Channel
-	// This will be skipped if opted for private messages due to num not being reset.
-	if num < 0 {
-		var i = 1
 
-		var channelsTotal = con.config.Core.Links[watched.guildID]
-		fmt.Println("Select a channel by number: ")
-		for _, c := range channelsTotal {
+		var channels []*discordgo.Channel
+		names = []string{"all"}
+		fmt.Println("Select a channel by number or name: ")
+		for _, c := range con.config.Core.Links[watched.guildID] {
 			if c.Type == 0 {
-				fmt.Printf(" [%2d] %s\n", i, c.Name)
-				i++
 				channels = append(channels, c)
+				names = append(names, c.Name)
+				fmt.Printf(" [%2d] %s\n", len(channels), c.Name)
 			}
 		}
+
+		// Run until either "exit", "all", or a valid option is selected.
+		num, err = con.pick("Channel ['0' for all / 'exit' to exit]: ", names, 0)
+		if err != nil || num < 0 {
+			return err
+		}
+
+		if num > 0 {
+			watched.channelID = channels[num-1].ID
+			watched.channelName = channels[num-1].Name
+		} else {
+			// Number should be 0 to indicate "all"
+			watched.channelAll = true
+		}
 	}
 
-	// Run until either ",quit", ",all", or a valid integer is provided.
+	var input string
+	num = -1
 	for num < 0 {
-		fmt.Print("Channel number ['0' for all / 'exit' to exit]: ")
-		input, _ = reader.ReadString('\n')
-		input = stripWhiteSpace(input)
-		num, err = strconv.Atoi(input)
-		if strings.ToLower(input) == "exit" {
-			return nil
-		} else if err != nil {
+		if input, err = con.prompt("Amount of messages to pull from database: ", nil); err != nil {
+			return err
+		} else if num, err = strconv.Atoi(input); err != nil {
 			num = -1
 			continue
-		} else if num >= 0 && num <= len(channels) {
-			break
 		}
 	}
+	amount := num
 
-	if num > 0 && num <= len(channels) {
-		watched.channelID = channels[num-1].ID
-		watched.channelName = channels[num-1].Name
-	} else {
-		// Number should be 0 to indicate "all"
-		watched.channelAll = true
+	num, err = con.pick("Output to [0] this terminal, [1] TCP port, [2] Unix socket: ",
+		[]string{"terminal", "tcp", "unix"}, 0)
+	if err != nil || num < 0 {
+		return err
 	}
 
-	num = -1
-	for num < 0 {
-		fmt.Print("Amount of messages to pull from database: ")
-		input, _ = reader.ReadString('\n')
-		input = stripWhiteSpace(input)
-		if num, err = strconv.Atoi(input); err != nil {
-			continue
+	// Never leave the watcher open without a token.
+	var token string
+	if num > 0 {
+		if token, err = con.config.watchTokenGet(); err != nil {
+			return err
 		}
 	}
 
 	// Start the channel (for communicating to go routine),
 	// add to our list of watchers and start the actual server.
-	watched.channel = make(chan string)
-	con.config.watched = append(con.config.watched, watched)
-
-	var serverStarted chan string
-	serverStarted = make(chan string)
-
-	go con.watchServer(watched, serverStarted, num)
-
-	msg := <-serverStarted
-	close(serverStarted)
-	fmt.Print("Server status: " + msg + "\n")
+	watched.channel = make(chan WatchEvent, watchBuffer)
+	watched.quit = make(chan struct{})
+	con.config.watchAdd(watched)
+
+	switch num {
+	case 1:
+		// Let the system pick a free port.
+		watched.ln, err = net.Listen("tcp", "127.0.0.1:0")
+		if err == nil {
+			_, port, _ := net.SplitHostPort(watched.ln.Addr().String())
+			fmt.Printf("Attach with: %s -watcher -host 127.0.0.1 -port %s\n", os.Args[0], port)
+		}
+	case 2:
+		path := filepath.Join(os.TempDir(), fmt.Sprintf("schinet-watch-%d-%d.sock", os.Getpid(), watched.id))
+		watched.ln, err = net.Listen("unix", path)
+		if err == nil {
+			fmt.Printf("Attach with: %s -watcher -socket %s\n", os.Args[0], path)
+		}
+	}
+	if err != nil {
+		con.config.watchRemove(watched.id)
+		return err
+	}
 
-	// Send archived messages desired.
-	if err := con.watchGetLast(watched, num); err != nil {
-		fmt.Println("Processing archived messages: " + err.Error())
+	if watched.ln != nil {
+		fmt.Println("Clients authenticate with '-token " + token + "'.")
 	}
 
+	go con.config.watchServer(watched, amount)
 	return nil
 }
 
 // WatchKill a particular watch/logger.
 func (con *console) WatchKill() error {
+	watched := con.config.watchList()
+	if len(watched) == 0 {
+		return errors.New("nothing is being watched")
+	}
+
 	fmt.Println("Select a watcher to kill")
-	for n, w := range con.config.watched {
+	for n, w := range watched {
 		fmt.Printf(" [%2d] %s ", n+1, w.guildName)
 		if w.channelName != "" {
 			fmt.Printf("-> %s", w.channelName)
@@ -281,218 +341,77 @@ func (con *console) WatchKill() error {
 		fmt.Print("\n")
 	}
 
-	var input string
-	var num = 0
-	reader := bufio.NewReader(os.Stdin)
-
 	// Run until a valid number is provided to kill OR "exit" to cancel.
-	for num < 1 {
-		fmt.Print("Number to kill ['exit' to exit]: ")
-		input, _ = reader.ReadString('\n')
-		num, _ = strconv.Atoi(stripWhiteSpace(input))
-
-		// Break and return to main console loop.
-		if strings.ToLower(stripWhiteSpace(input)) == "exit" {
-			break
-		}
-
-		// Send the "[PID]die" string to tell the distant logger to exit and close.
-		if num > 0 && num <= len(con.config.watched) {
-			w := con.config.watched[num-1]
-			w.Talk(w.pid + "die")
-
-			break
-		}
+	var numbers []string
+	for n := range watched {
+		numbers = append(numbers, strconv.Itoa(n+1))
 	}
+	num, err := con.pick("Number to kill ['exit' to exit]: ", numbers, 1)
+	if err != nil || num < 0 {
+		return err
+	}
+
+	// Stop the watcher, disconnecting its client.
+	watched[num-1].Stop()
 	return nil
 }
 
-// watchServer launches a need server that a client can connect to- to get information.
-func (con *console) watchServer(watch WatchLog, serverStarted chan string, amount int) {
-	fmt.Println("Starting new WatchLog...")
+// Alias adds, removes, and lists the global aliases.
+func (con *console) Alias() error {
+	if len(con.input) < 2 {
+		return errors.New("usage: alias [list | add caller \"linked\" | remove caller]")
+	}
 
-	var portBase = 8444
-	// Get an open port.
-	var portN = portBase
-	var passes = 0
-	for {
-		passes++
-		for _, w := range con.config.watched {
-			if w.port == portN {
-				portN++
-			}
+	user := UserNew(con.config.Core.User)
+	switch strings.ToLower(con.input[1]) {
+	case "list":
+		alias := AliasNew("", "", AliasGlobal, user)
+		msg, err := alias.List()
+		if err != nil {
+			return err
 		}
-		if passes > 2 {
-			break
+		fmt.Println(strings.Trim(msg, "`"))
+	case "add":
+		if len(con.input) < 4 {
+			return errors.New("usage: alias add caller \"linked\"")
 		}
-	}
-
-	hostS := "127.0.0.1"
-	portS := strconv.Itoa(portN)
-
-	// Launch a new window (WINDOWS SPECIFIC- NEED CHANGING.)
-	// TAG: TODO - *nix compatible.
-	cmd := exec.Command("cmd", "/C", "start", "SchiNET.exe", "-watcher", "-host", hostS, "-port", portS)
-	if err := cmd.Start(); err != nil {
-		fmt.Println(err)
-		return
-	}
-
-	fmt.Println("Granting " + hostS + ":" + portS + " to connect too.")
-	ln, err := net.Listen("tcp", ":"+portS)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	defer ln.Close()
-
-	conn, _ := ln.Accept()
-
-	// Retrieve the client's (CHILD) PID.
-	pID, _ := bufio.NewReader(conn).ReadString('\n')
-	pID = stripWhiteSpace(pID)
-	cmd.Process.Pid, _ = strconv.Atoi(pID)
-
-	// Unneeded currently.
-	//con.config.children = append(con.config.children, cmd)
-
-	fmt.Println("Child's PID: " + pID)
-
-	var watchedN int
-	// Find the correct watcher, and assign the PID supplied by child.
-	for n, w := range con.config.watched {
-		if w.guildID == watch.guildID {
-			watchedN = n
-			con.config.watched[n].pid = pID
-			con.config.watched[n].port = portN
+		alias := AliasNew(con.input[2], strings.Join(con.input[3:], " "), AliasGlobal, user)
+		if err := alias.Validate(); err != nil {
+			return err
+		} else if err := alias.Chain(); err != nil {
+			return err
+		} else if err := alias.Update(); err != nil {
+			return err
 		}
-	}
-
-	// Initiated text sent to client.
-	var init = "Initiated: " + watch.guildName
-	if watch.channelName != "" {
-		init += " on " + watch.channelName
-	}
-
-	// Send our "Initiated" string to child.
-	conn.Write([]byte("--> " + init + "\n\n"))
-
-	serverStarted <- "ok"
-
-	// Loop until "[PID]die" is supplied to terminate connection.
-	for msg := range watch.channel {
-		_, err = conn.Write([]byte(msg + "\n"))
-		if err != nil {
-			fmt.Println(err)
+		fmt.Printf("Global alias added: %s -> %s\n", alias.Caller, alias.Linked)
+	case "remove":
+		if len(con.input) < 3 {
+			return errors.New("usage: alias remove caller")
 		}
-		if msg == pID+"die" {
-			break
+		alias := AliasNew(con.input[2], "", AliasGlobal, user)
+		if err := alias.Remove(); err != nil {
+			return err
 		}
-		// Small pause, no pause resulted in lost messages.
-		time.Sleep(time.Millisecond)
-	}
-
-	// Remove it from the active watchers slices.
-	if len(con.config.watched) == 1 {
-		con.config.watched = nil
-	} else {
-		con.config.watched[watchedN] = con.config.watched[len(con.config.watched)-1]
-		con.config.watched = con.config.watched[:len(con.config.watched)-1]
-	}
-
-	// Close the socket.
-	close(watch.channel)
-	conn.Close()
-	fmt.Println("PID [" + pID + "] killed.")
-}
-
-// watchGetLast retrieves X amount of messages from database to forward to watch client.
-func (con *console) watchGetLast(watch WatchLog, amount int) error {
-	// Prevent attempting bad number of messages.
-	if amount <= 0 {
-		return nil
-	}
-
-	var q = make(map[string]interface{})
-	if watch.channelID != "" {
-		q["channelid"] = watch.channelID
-	} else {
-		q = nil
-	}
-
-	var err error
-	dbdat := DBdataCreate(watch.guildID, CollectionMessages, Message{}, q, nil)
-	if err = dbdat.dbGetWithLimit(Message{}, []string{"-timestamp"}, amount); err != nil {
-		return err
-	}
-
-	var msgs []Message
-	var msg Message
-	for _, m := range dbdat.Documents {
-		msg = m.(Message)
-		msgs = append(msgs, msg)
-	}
-
-	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
-		msgs[i], msgs[j] = msgs[j], msgs[i]
-	}
-
-	for _, m := range msgs {
-		output := watch.MessageCreate(m.Author.Name, m.Author.Discriminator, m.ChannelName, m.Content)
-		watch.Talk(output)
+		fmt.Println("Global alias removed: " + alias.Caller)
+	default:
+		return errors.New("unknown alias action, use: list, add, or remove")
 	}
-
 	return nil
 }
 
-// MessageCreate converts a message to proper output for Talk.
-func (watch WatchLog) MessageCreate(username, discriminator, channel, content string) string {
-	// Compose the message to send to the channel then the socket.
-	var output = "--> "
-	if watch.channelAll && channel != "" {
-		output += "[" + channel + "]"
-		// Check that we are monitoring this channel if any...
-	}
-
-	// Eventually add support for ContentWithMoreMentionsReplaced()
-	output += "[" + username + "#" + discriminator + "] " + content
-
-	return output
-}
-
-// Talk sends a message over a channel.
-func (watch WatchLog) Talk(msg string) {
-	watch.channel <- msg
-}
-
 // Info will display bits of the guild structure.
 func (con *console) Info() error {
 	var guilds = con.config.Core.Guilds
 	// List available guilds.
-	fmt.Println("Select a guild by number: ")
+	fmt.Println("Select a guild by number or name: ")
 	for n, g := range guilds {
 		fmt.Printf(" [%2d] %s\n", n, g.Name)
 	}
 
-	var num = -1
-	var input string
-	var err error
-	reader := bufio.NewReader(os.Stdin)
-
-	// Run until either ",quit" or a valid option is selected.
-	for num < 0 {
-		fmt.Print("Guild number [type 'exit' to exit]: ")
-		input, _ = reader.ReadString('\n')
-		input = stripWhiteSpace(input)
-		num, err = strconv.Atoi(input)
-		if strings.ToLower(input) == "exit" {
-			break
-		} else if err != nil {
-			num = -1
-			continue
-		} else if num >= 0 && num < len(guilds) {
-			break
-		}
+	// Run until either "exit" or a valid option is selected.
+	num, err := con.pick("Guild [type 'exit' to exit]: ", con.guildNames(), 0)
+	if err != nil || num < 0 {
+		return err
 	}
 
 	guild := con.config.Core.Guilds[num]
@@ -503,10 +422,8 @@ func (con *console) Info() error {
 }
 
 func consoleHelp() string {
-	text := [...]string{"check", "watch", "reset", "kill", "info", "help", "exit"}
-
 	var retText string
-	for n, w := range text {
+	for n, w := range consoleCommands {
 		retText += fmt.Sprintf("%10s ", w)
 		if (n+1)%4 == 0 && n != 0 {
 			retText += "\n"
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+// consoleHistory is the file in the user's home that keeps the console's history.
+const consoleHistory = ".schinet_history"
+
+// consoleCommands are the commands known to the console, for help and completion.
+var consoleCommands = [...]string{"check", "watch", "reset", "kill", "info", "alias",
+	"guilds", "channels", "members", "send", "embed", "run",
+	"grant", "revoke", "reload", "stats", "archive", "import", "spawn", "help", "exit"}
+
+// consoleCommand checks if a command is known to the console.
+func consoleCommand(name string) bool {
+	for _, c := range consoleCommands {
+		if strings.EqualFold(c, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// consoleCompleter completes commands, guild names, channel names and roles on
+// the console.
+type consoleCompleter struct {
+	config  *Config
+	options []string // Set when answering a prompt instead of a command.
+}
+
+// lineNew creates the line editor used by the console.
+func (cfg *Config) lineNew() (*readline.Instance, error) {
+	var history string
+	if home, err := os.UserHomeDir(); err == nil {
+		history = filepath.Join(home, consoleHistory)
+	}
+
+	return readline.NewEx(&readline.Config{
+		HistoryFile:       history,
+		HistorySearchFold: true,
+		AutoComplete:      &consoleCompleter{config: cfg},
+		InterruptPrompt:   "^C",
+		EOFPrompt:         "exit",
+	})
+}
+
+// consoleOut is where output is written while the console is reading, so the
+// prompt is redrawn after it.
+func (cfg *Config) consoleOut() io.Writer {
+	if cfg.line != nil {
+		return cfg.line.Stdout()
+	}
+	return os.Stdout
+}
+
+// Do returns the candidates to complete the word before the cursor with.
+func (cc *consoleCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	// The word being completed starts after the last space outside of quotes.
+	var start int
+	var quoted bool
+	for n, r := range line[:pos] {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ' ' && !quoted {
+			start = n + 1
+		}
+	}
+	word := []rune(strings.ToLower(string(line[start:pos])))
+	_, words := strToCommands(string(line[:start]), ConfigFile.Prefix)
+
+	var candidates []string
+	if cc.options != nil {
+		candidates = cc.options
+	} else {
+		candidates = cc.candidates(words)
+	}
+
+	var found [][]rune
+	for _, c := range candidates {
+		if strings.Contains(c, " ") {
+			c = "\"" + c + "\""
+		}
+		r := []rune(c)
+		if len(r) >= len(word) && strings.ToLower(string(r[:len(word)])) == string(word) {
+			found = append(found, append(r[len(word):], ' '))
+		}
+	}
+	return found, len(word)
+}
+
+// candidates are what could follow the words of a command.
+func (cc *consoleCompleter) candidates(words []string) []string {
+	// Spawned commands complete like any other.
+	for len(words) > 0 && strings.ToLower(words[0]) == "spawn" {
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return consoleCommands[:]
+	}
+
+	con := console{config: cc.config}
+	cmd := strings.ToLower(words[0])
+	switch cmd {
+	case "check", "channels", "members", "stats":
+		if len(words) == 1 {
+			return con.guildNames()
+		}
+	case "archive":
+		switch {
+		case len(words) == 1:
+			return con.guildNames()
+		case words[len(words)-1] == "--format" || words[len(words)-1] == "-f":
+			return archiveFormats
+		case words[len(words)-1] == "--channel" || words[len(words)-1] == "-c":
+			return con.channelNames(words[1])
+		}
+	case "send", "embed", "grant", "revoke", "run":
+		switch {
+		case len(words) == 1:
+			return con.guildNames()
+		case len(words) == 2 && cmd == "run":
+			return []string{"bot"}
+		case len(words) == 2, len(words) == 3 && cmd == "run":
+			return con.channelNames(words[1])
+		case len(words) == 3 && (cmd == "grant" || cmd == "revoke"):
+			return []string{"admin", "mod", "ban"}
+		}
+	case "import":
+		if len(words) == 2 {
+			return con.guildNames()
+		}
+	case "alias":
+		if len(words) == 1 {
+			return []string{"list", "add", "remove"}
+		}
+	case "reset":
+		if len(words) == 1 {
+			return []string{"credits"}
+		}
+	}
+	return nil
+}
+
+// guildNames are the names of the guilds the bot is in.
+func (con *console) guildNames() []string {
+	var names []string
+	for _, g := range con.config.Core.Guilds {
+		names = append(names, g.Name)
+	}
+	return names
+}
+
+// channelNames are the names of a guild's text channels.
+func (con *console) channelNames(guild string) []string {
+	g, err := con.guildFind(guild)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, c := range con.config.Core.Links[g.ID] {
+		if c.Type == 0 {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// prompt asks for a line of input, completing it from the options given. The
+// answer is kept out of the history.
+func (con *console) prompt(text string, options []string) (string, error) {
+	line := con.config.line
+	if line == nil {
+		// Not on the console (such as -exec), read plainly.
+		os.Stdout.WriteString(text)
+		input, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		return strings.TrimSpace(input), err
+	}
+
+	cfg := line.Config.Clone()
+	cfg.Prompt = text
+	cfg.AutoComplete = &consoleCompleter{config: con.config, options: options}
+	cfg.HistoryFile = ""
+	cfg.DisableAutoSaveHistory = true
+	old := line.SetConfig(cfg)
+	defer line.SetConfig(old)
+
+	input, err := line.Readline()
+	return strings.TrimSpace(input), err
+}
+
+// pick asks for one of the options by its number or its name, returning its
+// number. Numbers start at first, -1 is returned for 'exit'.
+func (con *console) pick(text string, options []string, first int) (int, error) {
+	for {
+		input, err := con.prompt(text, append(options[:len(options):len(options)], "exit"))
+		if err != nil {
+			return -1, err
+		} else if strings.ToLower(input) == "exit" {
+			return -1, nil
+		}
+
+		if num, err := strconv.Atoi(input); err == nil {
+			if num >= first && num < len(options)+first {
+				return num, nil
+			}
+			continue
+		}
+
+		input = strings.Trim(input, "\"")
+		for n, o := range options {
+			if strings.EqualFold(o, input) {
+				return n + first, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// consoleRoles maps the names used on the console to the bot's role bases.
+var consoleRoles = map[string]int{
+	"admin": rolePermissionAdmin,
+	"mod":   rolePermissionMod,
+	"ban":   rolePermissionBan,
+}
+
+// guildFind gets a guild by its number in 'guilds', its ID, or its name.
+// A partial name works as long as only one guild matches it.
+func (con *console) guildFind(arg string) (*discordgo.Guild, error) {
+	var guilds = con.config.Core.Guilds
+	if n, err := strconv.Atoi(arg); err == nil && n >= 0 && n < len(guilds) {
+		return guilds[n], nil
+	}
+
+	var found []*discordgo.Guild
+	for _, g := range guilds {
+		if g.ID == arg || strings.EqualFold(g.Name, arg) {
+			return g, nil
+		} else if strings.Contains(strings.ToLower(g.Name), strings.ToLower(arg)) {
+			found = append(found, g)
+		}
+	}
+
+	if len(found) == 1 {
+		return found[0], nil
+	} else if len(found) > 1 {
+		return nil, fmt.Errorf("'%s' matches %d guilds, be more specific", arg, len(found))
+	}
+	return nil, ErrGuildUnknown
+}
+
+// channelFind gets a text channel of a guild by its ID or its name.
+func (con *console) channelFind(guildID, arg string) (*discordgo.Channel, error) {
+	arg = strings.TrimPrefix(strings.TrimSuffix(strings.TrimPrefix(arg, "<#"), ">"), "#")
+	for _, c := range con.config.Core.Links[guildID] {
+		if c.Type == 0 && (c.ID == arg || strings.EqualFold(c.Name, arg)) {
+			return c, nil
+		}
+	}
+	return nil, ErrChannelUnknown
+}
+
+// Guilds lists the guilds the bot is in.
+func (con *console) Guilds() error {
+	for n, g := range con.config.Core.Guilds {
+		fmt.Printf(" [%2d] %-32s %s\n", n, g.Name, g.ID)
+	}
+	return nil
+}
+
+// Channels lists the channels of a guild.
+func (con *console) Channels() error {
+	if len(con.input) < 2 {
+		return errors.New("usage: channels [guild]")
+	}
+
+	guild, err := con.guildFind(con.input[1])
+	if err != nil {
+		return err
+	}
+
+	for _, c := range con.config.Core.Links[guild.ID] {
+		var kind = "text"
+		if c.Type != 0 {
+			kind = "other"
+		}
+		fmt.Printf(" %-6s %-32s %s\n", kind, c.Name, c.ID)
+	}
+	return nil
+}
+
+// Members lists the members of a guild along with any of the bot's roles they hold.
+func (con *console) Members() error {
+	if len(con.input) < 2 {
+		return errors.New("usage: members [guild]")
+	}
+
+	guild, err := con.guildFind(con.input[1])
+	if err != nil {
+		return err
+	}
+
+	members, err := con.config.Core.GetGuildMembers(guild.ID, guild.MemberCount)
+	if err != nil {
+		return err
+	}
+
+	gc := con.config.GuildConfigByID(guild.ID)
+	for _, m := range members {
+		var roles []string
+		if gc != nil {
+			for _, name := range []string{"admin", "mod", "ban"} {
+				for _, r := range m.Roles {
+					if roleID := gc.RoleIDGet(consoleRoles[name]); roleID != "" && r == roleID {
+						roles = append(roles, name)
+					}
+				}
+			}
+		}
+		fmt.Printf(" %-37s %-20s %s\n", m.User.Username+"#"+m.User.Discriminator, m.User.ID, strings.Join(roles, ", "))
+	}
+	fmt.Printf("Total: %d\n", len(members))
+	return nil
+}
+
+// Send posts a message, or an embed, to a guild's channel.
+func (con *console) Send(embed bool) error {
+	if len(con.input) < 4 {
+		return fmt.Errorf("usage: %s [guild] [channel] [text]", con.input[0])
+	}
+
+	guild, err := con.guildFind(con.input[1])
+	if err != nil {
+		return err
+	}
+	channel, err := con.channelFind(guild.ID, con.input[2])
+	if err != nil {
+		return err
+	}
+
+	var color int
+	if embed {
+		color = ColorBlue
+	}
+	if _, err = con.config.channelSend(guild.ID, channel.ID, strings.Join(con.input[3:], " "), color); err != nil {
+		return err
+	}
+	fmt.Printf("Sent to %s -> #%s\n", guild.Name, channel.Name)
+	return nil
+}
+
+// Run executes a chat command in a guild's channel as a user, printing and
+// posting the result.
+func (con *console) Run() error {
+	if len(con.input) < 5 {
+		return errors.New("usage: run [guild] [user] [channel] [command]")
+	}
+
+	guild, err := con.guildFind(con.input[1])
+	if err != nil {
+		return err
+	}
+	channel, err := con.channelFind(guild.ID, con.input[3])
+	if err != nil {
+		return err
+	}
+
+	// 'bot' runs the command as the bot itself.
+	var userID = con.input[2]
+	if strings.ToLower(userID) == "bot" {
+		userID = ""
+	}
+
+	dat, err := con.config.ioDataCreate(guild.ID, channel.ID, userID, strings.Join(con.input[4:], " "))
+	if err != nil {
+		return err
+	} else if err = con.config.ioExec(dat, true); err != nil {
+		return err
+	}
+
+	if dat.output != "" {
+		fmt.Println(dat.output)
+	} else if dat.msgEmbed != nil {
+		fmt.Println(dat.msgEmbed.Description)
+	}
+	return nil
+}
+
+// Role grants or revokes one of the bot's roles for a user in a guild.
+func (con *console) Role(grant bool) error {
+	if len(con.input) < 4 {
+		return fmt.Errorf("usage: %s [guild] [user] [admin | mod | ban]", con.input[0])
+	}
+
+	guild, err := con.guildFind(con.input[1])
+	if err != nil {
+		return err
+	}
+	gc := con.config.GuildConfigByID(guild.ID)
+	if gc == nil {
+		return ErrGuildUnknown
+	}
+
+	base, ok := consoleRoles[strings.ToLower(con.input[3])]
+	if !ok {
+		return errors.New("unknown role, use: admin, mod, or ban")
+	}
+
+	userID := userIDParse(con.input[2])
+	if err = userRoleSet(con.config.Core.Session, gc, userID, base, grant); err != nil {
+		return err
+	}
+
+	if grant {
+		fmt.Printf("Granted %s to %s in %s\n", con.input[3], userID, guild.Name)
+	} else {
+		fmt.Printf("Revoked %s from %s in %s\n", con.input[3], userID, guild.Name)
+	}
+	return nil
+}
+
+// Reload re-reads the guild configurations from the database.
+func (con *console) Reload() error {
+	if err := con.config.GuildConfigLoad(); err != nil {
+		return err
+	}
+	fmt.Printf("Reloaded %d guild configs.\n", len(con.config.GuildConf))
+	return nil
+}
+
+// Stats displays the numbers behind a guild.
+func (con *console) Stats() error {
+	if len(con.input) < 2 {
+		return errors.New("usage: stats [guild]")
+	}
+
+	guild, err := con.guildFind(con.input[1])
+	if err != nil {
+		return err
+	}
+
+	var text, other int
+	for _, c := range con.config.Core.Links[guild.ID] {
+		if c.Type == 0 {
+			text++
+		} else {
+			other++
+		}
+	}
+
+	var count = func(collection string) int {
+		dbdat := DBdataCreate(guild.ID, collection, nil, nil, nil)
+		n, err := dbdat.dbCount()
+		if err != nil {
+			return 0
+		}
+		return n
+	}
+
+	var open, total int
+	dbdat := DBdataCreate(guild.ID, CollectionTickets, Ticket{}, nil, nil)
+	if err = dbdat.dbGetAll(Ticket{}); err == nil {
+		for _, t := range dbdat.Documents {
+			if t.(Ticket).Open {
+				open++
+			}
+		}
+		total = len(dbdat.Documents)
+	}
+
+	var watchers int
+	for _, w := range con.config.watchList() {
+		if w.guildID == guild.ID {
+			watchers++
+		}
+	}
+
+	var prefix = ConfigFile.Prefix
+	if gc := con.config.GuildConfigByID(guild.ID); gc != nil {
+		prefix = gc.Prefix
+	}
+
+	fmt.Printf("\n%s\n ID: %s\n Prefix: %s\n Members: %d\n Channels: %d text, %d other\n"+
+		" Messages archived: %d\n Tickets: %d open, %d total\n Events: %d\n"+
+		" Aliases: %d\n Scripts: %d\n Watchers: %d\n\n",
+		guild.Name, guild.ID, prefix, guild.MemberCount, text, other,
+		count(CollectionMessages), open, total, count(CollectionEvents),
+		count(CollectionAlias), count(CollectionScripts), watchers)
+	return nil
+}
+
+// Archive exports a guild's archived messages to a file.
+func (con *console) Archive() error {
+	ex, words, usage, err := archiveFlags(con.input)
+	if err != nil {
+		return err
+	} else if usage != "" {
+		fmt.Println(strings.Trim(usage, "`"))
+		return nil
+	} else if len(words) == 0 {
+		return errors.New("usage: archive [guild] [--format jsonl | csv | html] [--channel] [--after] [--before] [--out]")
+	}
+
+	guild, err := con.guildFind(words[0])
+	if err != nil {
+		return err
+	}
+	ex.GuildID = guild.ID
+	ex.GuildName = guild.Name
+
+	path, n, err := ex.WriteFile()
+	if err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New("no messages found")
+	}
+	fmt.Printf("Exported %d messages to %s\n", n, path)
+	return nil
+}
+
+// Import archives the messages of Discord chat exports, a file or a directory
+// of them, into the guild they came from or the one given.
+func (con *console) Import() error {
+	if len(con.input) < 2 {
+		return errors.New("usage: import [file or directory] [guild]")
+	}
+
+	// Guilds the bot has left can be given by ID.
+	var guildID string
+	if len(con.input) > 2 {
+		guildID = con.input[2]
+		if guild, err := con.guildFind(guildID); err == nil {
+			guildID = guild.ID
+		}
+	}
+
+	results, err := archiveImport(con.input[1], guildID)
+	if err != nil {
+		return err
+	}
+
+	var added, failed int
+	for _, r := range results {
+		fmt.Println(" " + r.String())
+		added += r.Added
+		if r.Err != nil {
+			failed++
+		}
+	}
+	fmt.Printf("Imported %d messages from %d files.\n", added, len(results)-failed)
+
+	if failed > 0 {
+		return fmt.Errorf("%d files failed to import", failed)
+	}
+	return nil
+}
@@ -0,0 +1,860 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Constants for the dashboard.
+const (
+	dashCookie      = "schinet_session" // Cookie holding the session token.
+	dashSessionLife = 12 * time.Hour    // How long a login lasts.
+	dashBodyMax     = 1 << 20           // Largest request body accepted.
+)
+
+// Errors for the dashboard.
+var (
+	ErrDashNotFound = errors.New("not found")
+	ErrDashMethod   = errors.New("method not allowed")
+)
+
+// dashboard is the embedded web interface for watching and administering guilds,
+// and the JSON API it uses, which other tools can use with a token.
+type dashboard struct {
+	cfg      *Config
+	upgrader websocket.Upgrader
+
+	sessions   map[string]time.Time // Session tokens and when they expire.
+	sessionsMu sync.Mutex
+}
+
+// dashGuild is a guild, and its text channels, that can be watched.
+type dashGuild struct {
+	ID       string
+	Name     string
+	Channels []ChannelInfo
+}
+
+// dashboardStart serves the dashboard if it is configured.
+func (cfg *Config) dashboardStart() error {
+	if ConfigFile.Dashboard == "" {
+		return nil
+	} else if !dashLoginEnabled() && ConfigFile.APIToken == "" {
+		return errors.New("dashboard needs 'DashboardUser' and 'DashboardPassword', or 'APIToken' in conf.json")
+	}
+
+	d := &dashboard{cfg: cfg, sessions: make(map[string]time.Time)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", d.index)
+	mux.HandleFunc("/login", d.login)
+	mux.HandleFunc("/logout", d.logout)
+	mux.HandleFunc("/api/guilds", d.auth(d.guilds))
+	mux.HandleFunc("/api/guild/", d.auth(d.guild))
+	mux.HandleFunc("/api/watch", d.auth(d.watch))
+	mux.HandleFunc("/api/users/", d.auth(d.users))
+	mux.HandleFunc("/api/alliances", d.auth(d.alliances))
+	mux.HandleFunc("/api/alliances/", d.auth(d.alliances))
+
+	ln, err := net.Listen("tcp", ConfigFile.Dashboard)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Dashboard listening on http://" + ln.Addr().String())
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			fmt.Println("Dashboard stopped: " + err.Error())
+		}
+	}()
+	return nil
+}
+
+// auth only lets requests with the API token or a valid session through. Requests
+// that change anything must be JSON, which browsers won't send across sites without asking.
+func (d *dashboard) auth(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if dashToken(r) {
+			h(w, r)
+			return
+		} else if !d.session(r) {
+			dashError(w, http.StatusUnauthorized, errors.New("login required"))
+			return
+		}
+
+		if r.Method != "GET" && !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			dashError(w, http.StatusUnsupportedMediaType, errors.New("requests must be JSON"))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// dashToken checks the request's "Authorization: Bearer" token.
+func dashToken(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ConfigFile.APIToken == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(ConfigFile.APIToken)) == 1
+}
+
+// dashLoginEnabled is true if there are credentials to log in to the dashboard with.
+func dashLoginEnabled() bool {
+	return ConfigFile.DashboardUser != "" && ConfigFile.DashboardPassword != ""
+}
+
+// session checks the request's session cookie.
+func (d *dashboard) session(r *http.Request) bool {
+	c, err := r.Cookie(dashCookie)
+	if err != nil {
+		return false
+	}
+
+	d.sessionsMu.Lock()
+	defer d.sessionsMu.Unlock()
+	expires, ok := d.sessions[c.Value]
+	if ok && time.Now().After(expires) {
+		delete(d.sessions, c.Value)
+		return false
+	}
+	return ok
+}
+
+// login checks the credentials posted and starts a session.
+func (d *dashboard) login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || !dashLoginEnabled() {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	user := subtle.ConstantTimeCompare([]byte(r.PostFormValue("user")), []byte(ConfigFile.DashboardUser))
+	pass := subtle.ConstantTimeCompare([]byte(r.PostFormValue("password")), []byte(ConfigFile.DashboardPassword))
+	if user&pass != 1 {
+		// Slow down guessing.
+		time.Sleep(time.Second)
+		fmt.Println("Dashboard: failed login from " + r.RemoteAddr)
+		http.Redirect(w, r, "/?failed", http.StatusSeeOther)
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		dashError(w, http.StatusInternalServerError, err)
+		return
+	}
+	token := hex.EncodeToString(b)
+	expires := time.Now().Add(dashSessionLife)
+
+	d.sessionsMu.Lock()
+	d.sessions[token] = expires
+	d.sessionsMu.Unlock()
+
+	// Lax so links to stored files from Discord open, only GETs from other sites send it.
+	http.SetCookie(w, &http.Cookie{Name: dashCookie, Value: token, Path: "/", Expires: expires,
+		HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// logout ends the session.
+func (d *dashboard) logout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(dashCookie); err == nil && r.Method == "POST" {
+		d.sessionsMu.Lock()
+		delete(d.sessions, c.Value)
+		d.sessionsMu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: dashCookie, Value: "", Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// index serves the login page, or the dashboard once logged in.
+func (d *dashboard) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if !dashLoginEnabled() {
+		fmt.Fprint(w, "The dashboard login is disabled, only the API can be used.")
+		return
+	} else if !d.session(r) {
+		fmt.Fprint(w, dashLoginHTML)
+		return
+	}
+	fmt.Fprint(w, dashHTML)
+}
+
+// guilds lists the guilds and their text channels.
+func (d *dashboard) guilds(w http.ResponseWriter, r *http.Request) {
+	var guilds = []dashGuild{{ID: "private", Name: "Private Messages"}}
+	for _, g := range d.cfg.Core.Guilds {
+		dg := dashGuild{ID: g.ID, Name: g.Name}
+		for _, c := range d.cfg.Core.Links[g.ID] {
+			if c.Type == 0 {
+				dg.Channels = append(dg.Channels, ChannelInfo{ID: c.ID, Name: c.Name, Server: g.ID})
+			}
+		}
+		guilds = append(guilds, dg)
+	}
+	dashJSON(w, guilds)
+}
+
+// guild routes /api/guild/{id}/{section} to the section's handler.
+func (d *dashboard) guild(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/guild/"), "/"), "/")
+	if len(parts) == 3 && parts[1] == "files" {
+		d.file(w, r, parts[0], parts[2])
+		return
+	} else if len(parts) != 2 {
+		dashError(w, http.StatusNotFound, ErrDashNotFound)
+		return
+	}
+
+	guildID, section := parts[0], parts[1]
+
+	// Global aliases belong to no guild.
+	if section == "aliases" && guildID == "global" {
+		guildID = AliasGlobal
+	} else if d.cfg.GuildConfigByID(guildID) == nil {
+		dashError(w, http.StatusNotFound, ErrGuildUnknown)
+		return
+	}
+
+	var v interface{}
+	var err error
+	switch section {
+	case "config":
+		v, err = d.config(r, guildID)
+	case "aliases":
+		v, err = d.aliases(r, guildID)
+	case "events":
+		v, err = d.events(r, guildID)
+	case "tickets":
+		v, err = d.tickets(r, guildID)
+	case "bans":
+		v, err = d.bans(r, guildID)
+	case "scripts":
+		v, err = d.scripts(r, guildID)
+	case "send":
+		v, err = d.send(r, guildID)
+	case "run":
+		v, err = d.run(r, guildID)
+	default:
+		err = ErrDashNotFound
+	}
+
+	dashRespond(w, v, err)
+}
+
+// file serves an attachment stored in a guild's blob store.
+func (d *dashboard) file(w http.ResponseWriter, r *http.Request, guildID, hash string) {
+	if r.Method != "GET" {
+		dashError(w, http.StatusMethodNotAllowed, ErrDashMethod)
+		return
+	} else if d.cfg.GuildConfigByID(guildID) == nil {
+		dashError(w, http.StatusNotFound, ErrGuildUnknown)
+		return
+	} else if !blobHash(hash) {
+		dashError(w, http.StatusNotFound, ErrDashNotFound)
+		return
+	}
+
+	bs := &blobStore{GuildID: guildID}
+	blob, err := bs.Get(hash)
+	if err != nil {
+		dashRespond(w, nil, err)
+		return
+	}
+
+	if blob.ContentType != "" {
+		w.Header().Set("Content-Type", blob.ContentType)
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	http.ServeFile(w, r, bs.Path(hash))
+}
+
+// config gets or changes a guild's configuration.
+func (d *dashboard) config(r *http.Request, guildID string) (interface{}, error) {
+	gc := d.cfg.GuildConfigByID(guildID)
+	switch r.Method {
+	case "GET":
+		return gc, nil
+	case "POST":
+		var req struct{ Prefix string }
+		if err := dashDecode(r, &req); err != nil {
+			return nil, err
+		}
+
+		if req.Prefix = strings.TrimSpace(req.Prefix); req.Prefix == "" || strings.ContainsAny(req.Prefix, " \t\n") {
+			return nil, errors.New("prefix can't be empty or contain spaces")
+		}
+		gc.Prefix = req.Prefix
+		if err := d.cfg.GuildConfigManager(gc); err != nil {
+			return nil, err
+		}
+		return gc, nil
+	}
+	return nil, ErrDashMethod
+}
+
+// aliases lists, adds and removes a guild's aliases.
+func (d *dashboard) aliases(r *http.Request, guildID string) (interface{}, error) {
+	bot := UserNew(d.cfg.Core.User)
+	switch r.Method {
+	case "GET":
+		aliases, err := (&Alias{ServerID: guildID}).GetAll()
+		if err == ErrNoAliases {
+			return []Alias{}, nil
+		}
+		return aliases, err
+	case "POST":
+		var req struct{ Caller, Linked string }
+		if err := dashDecode(r, &req); err != nil {
+			return nil, err
+		} else if req.Caller == "" || req.Linked == "" {
+			return nil, errors.New("need a caller and what it links to")
+		}
+
+		alias := AliasNew(req.Caller, req.Linked, guildID, bot)
+		if err := alias.Validate(); err != nil {
+			return nil, err
+		} else if err := alias.Chain(); err != nil {
+			return nil, err
+		}
+		return alias, alias.Update()
+	case "DELETE":
+		caller := r.URL.Query().Get("caller")
+		if caller == "" {
+			return nil, errors.New("need the caller to remove")
+		}
+		alias := AliasNew(caller, "", guildID, bot)
+		return alias, alias.Remove()
+	}
+	return nil, ErrDashMethod
+}
+
+// events lists, adds and removes a guild's events.
+func (d *dashboard) events(r *http.Request, guildID string) (interface{}, error) {
+	bot := UserNew(d.cfg.Core.User)
+	switch r.Method {
+	case "GET":
+		dbdat := DBdataCreate(guildID, CollectionEvents, Event{}, nil, nil)
+		if err := dbdat.dbGetAll(Event{}); err != nil {
+			return nil, err
+		}
+
+		var events = []Event{}
+		for _, e := range dbdat.Documents {
+			events = append(events, e.(Event))
+		}
+		return events, nil
+	case "POST":
+		var req struct {
+			Description, Day, HHMM string
+			Protected              bool
+		}
+		if err := dashDecode(r, &req); err != nil {
+			return nil, err
+		} else if req.Description == "" || req.Day == "" {
+			return nil, errors.New("need a description and a day")
+		}
+
+		ev, err := EventNew(guildID, req.Description, req.Day, req.HHMM, bot, req.Protected)
+		if err != nil {
+			return nil, err
+		}
+		_, err = ev.Add()
+		return ev, err
+	case "DELETE":
+		q := r.URL.Query()
+		ev := &Event{ServerID: guildID, Day: q.Get("day"), HHMM: q.Get("hhmm"), AddedBy: bot.Basic()}
+		_, err := ev.Delete()
+		return ev, err
+	}
+	return nil, ErrDashMethod
+}
+
+// tickets lists a guild's tickets, and opens, closes, or adds notes to them.
+func (d *dashboard) tickets(r *http.Request, guildID string) (interface{}, error) {
+	switch r.Method {
+	case "GET":
+		dbdat := DBdataCreate(guildID, CollectionTickets, Ticket{}, nil, nil)
+		if err := dbdat.dbGetAll(Ticket{}); err != nil {
+			return nil, err
+		}
+
+		var tickets = []Ticket{}
+		for _, t := range dbdat.Documents {
+			tickets = append(tickets, t.(Ticket))
+		}
+		return tickets, nil
+	case "POST":
+		var req struct {
+			TicketID       *int // Ticket to change, a new ticket is added if not given.
+			Title, Comment string
+			Open           *bool
+			Note           string
+		}
+		if err := dashDecode(r, &req); err != nil {
+			return nil, err
+		}
+
+		// New tickets are added the same way the chat command adds them.
+		if req.TicketID == nil {
+			dat, err := d.cfg.ioDataCreate(guildID, "", "", "")
+			if err != nil {
+				return nil, err
+			}
+			dat.io = []string{"ticket", "--add", "--title", req.Title, "--comment", req.Comment}
+			if err = dat.CoreTickets(); err != nil {
+				return nil, err
+			}
+			return dashOutput(dat), nil
+		}
+
+		t := Ticket{ServerID: guildID}
+		if err := t.Get(*req.TicketID); err != nil {
+			return nil, err
+		}
+
+		if req.Title != "" {
+			t.Title = req.Title
+		}
+		if req.Comment != "" {
+			t.Comment = req.Comment
+		}
+		if req.Note != "" {
+			t.Notes = append(t.Notes, req.Note)
+		}
+		if req.Open != nil && *req.Open != t.Open {
+			t.Open = *req.Open
+			if !t.Open {
+				t.ClosedBy = UserNew(d.cfg.Core.User).Basic()
+				t.DateClosed = time.Now()
+			}
+		}
+		return t, t.Update()
+	}
+	return nil, ErrDashMethod
+}
+
+// bans lists the users who can't use the bot in a guild, and bans or unbans them.
+func (d *dashboard) bans(r *http.Request, guildID string) (interface{}, error) {
+	gc := d.cfg.GuildConfigByID(guildID)
+	switch r.Method {
+	case "GET":
+		roleID := gc.RoleIDGet(rolePermissionBan)
+		if roleID == "" {
+			return []UserBasic{}, nil
+		}
+
+		q := bson.M{"guildroles": bson.M{"$elemMatch": bson.M{"id": guildID, "roles": roleID}}}
+		dbdat := DBdataCreate(Database, CollectionUsers, User{}, q, nil)
+		if err := dbdat.dbGetWithLimit(User{}, []string{"username"}, 0); err != nil && err != mgo.ErrNotFound {
+			return nil, err
+		}
+
+		var users = []UserBasic{}
+		for _, u := range dbdat.Documents {
+			user := u.(User)
+			users = append(users, user.Basic())
+		}
+		return users, nil
+	case "POST", "DELETE":
+		userID := userIDParse(r.URL.Query().Get("user"))
+		if userID == "" {
+			return nil, errors.New("need the user's ID")
+		}
+		return userID, botAbuseSet(d.cfg.Core.Session, gc, userID, r.Method == "POST")
+	}
+	return nil, ErrDashMethod
+}
+
+// scripts lists, saves and removes the scripts in a guild's library.
+func (d *dashboard) scripts(r *http.Request, guildID string) (interface{}, error) {
+	lib := LibraryNew(guildID, nil)
+	lib.Location = -1
+	switch r.Method {
+	case "GET":
+		dbdat := DBdataCreate(guildID, CollectionScripts, Script{}, nil, nil)
+		if err := dbdat.dbGetAll(Script{}); err != nil {
+			return nil, err
+		}
+
+		var scripts = []Script{}
+		for _, s := range dbdat.Documents {
+			scripts = append(scripts, s.(Script))
+		}
+		return scripts, nil
+	case "POST":
+		var req struct {
+			Name, Content string
+			Version       float32
+			Author        string // User ID the script is saved under, the bot if empty.
+		}
+		if err := dashDecode(r, &req); err != nil {
+			return nil, err
+		} else if req.Name == "" || req.Content == "" {
+			return nil, errors.New("need a name and content")
+		}
+
+		author := UserNew(d.cfg.Core.User)
+		if req.Author != "" {
+			if err := author.Get(userIDParse(req.Author)); err != nil {
+				return nil, err
+			}
+		}
+
+		lib.Script = ScriptNew(req.Name, "", req.Version, author.Basic())
+		if _, err := lib.Save(req.Content); err != nil {
+			return nil, err
+		}
+		return lib.Script, nil
+	case "DELETE":
+		q := r.URL.Query()
+		if q.Get("name") == "" || q.Get("author") == "" {
+			return nil, errors.New("need the script's name and author name")
+		}
+		lib.Script = ScriptNew(q.Get("name"), "", 0, UserBasic{Name: q.Get("author")})
+		_, err := lib.Delete()
+		return lib.Script, err
+	}
+	return nil, ErrDashMethod
+}
+
+// send posts a message to one of a guild's channels.
+func (d *dashboard) send(r *http.Request, guildID string) (interface{}, error) {
+	if r.Method != "POST" {
+		return nil, ErrDashMethod
+	}
+
+	var req struct {
+		Channel, Content string
+		Color            int // Sent as an embed of this color if set.
+	}
+	if err := dashDecode(r, &req); err != nil {
+		return nil, err
+	}
+	return d.cfg.channelSend(guildID, req.Channel, req.Content, req.Color)
+}
+
+// run runs a chat command in a guild as a user, returning what it replied.
+func (d *dashboard) run(r *http.Request, guildID string) (interface{}, error) {
+	if r.Method != "POST" {
+		return nil, ErrDashMethod
+	}
+
+	var req struct {
+		Channel string // Channel it is run in, the guild's main channel if empty.
+		User    string // User it is run as, whose roles apply. The bot if empty.
+		Command string // Command without the prefix.
+		Post    bool   // Post the reply to the channel as well.
+	}
+	if err := dashDecode(r, &req); err != nil {
+		return nil, err
+	} else if strings.TrimSpace(req.Command) == "" {
+		return nil, errors.New("need a command")
+	}
+
+	dat, err := d.cfg.ioDataCreate(guildID, req.Channel, req.User, req.Command)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.cfg.ioExec(dat, req.Post); err != nil {
+		return nil, err
+	}
+	return dashOutput(dat), nil
+}
+
+// dashOutput is the reply of a command.
+func dashOutput(dat *IOdata) map[string]interface{} {
+	return map[string]interface{}{"Output": dat.output, "Embed": dat.msgEmbed}
+}
+
+// users gets a user, or changes their credits.
+func (d *dashboard) users(w http.ResponseWriter, r *http.Request) {
+	userID := userIDParse(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/users/"), "/"))
+	user := UserNew(nil)
+	if err := user.Get(userID); err != nil {
+		dashRespond(w, nil, err)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		dashJSON(w, user)
+	case "POST":
+		var req struct {
+			Credits *int // Sets the credits.
+			Add     int  // Adds to (or takes from) the credits.
+		}
+		if err := dashDecode(r, &req); err != nil {
+			dashRespond(w, nil, err)
+			return
+		}
+
+		if req.Credits != nil {
+			user.Credits = *req.Credits
+		}
+		user.Credits += req.Add
+		if user.Credits < 0 {
+			dashRespond(w, nil, errors.New("credits can't be negative"))
+			return
+		}
+		dashRespond(w, user, user.Update())
+	default:
+		dashRespond(w, nil, ErrDashMethod)
+	}
+}
+
+// alliances lists the alliances, gets one, or announces to one.
+func (d *dashboard) alliances(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/alliances"), "/"), "/")
+	if name == "" {
+		if r.Method != "GET" {
+			dashRespond(w, nil, ErrDashMethod)
+			return
+		}
+		dashJSON(w, d.cfg.Alliances)
+		return
+	}
+
+	ally := d.cfg.AllianceGet(name)
+	if ally == nil {
+		dashRespond(w, nil, ErrAllianceNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		dashJSON(w, ally)
+	case "POST":
+		var req struct{ Content string }
+		if err := dashDecode(r, &req); err != nil {
+			dashRespond(w, nil, err)
+			return
+		} else if strings.TrimSpace(req.Content) == "" {
+			dashRespond(w, nil, errors.New("nothing to announce"))
+			return
+		}
+		ally.Announce(d.cfg.Core.Session, embedCreator(req.Content, ColorBlue))
+		dashJSON(w, ally)
+	default:
+		dashRespond(w, nil, ErrDashMethod)
+	}
+}
+
+// watch streams a guild's WatchLog over a WebSocket.
+func (d *dashboard) watch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	watch := &WatchLog{
+		guildID:   q.Get("guild"),
+		channelID: q.Get("channel"),
+		channel:   make(chan WatchEvent, watchBuffer),
+		quit:      make(chan struct{}),
+	}
+
+	if watch.guildID == "private" {
+		watch.guildName = "private"
+	} else if g := d.cfg.Core.GetGuild(watch.guildID); g != nil {
+		watch.guildName = g.Name
+	} else {
+		dashError(w, http.StatusNotFound, ErrGuildUnknown)
+		return
+	}
+
+	watch.channelAll = watch.channelID == ""
+	for _, c := range d.cfg.Core.Links[watch.guildID] {
+		if c.ID == watch.channelID {
+			watch.channelName = c.Name
+		}
+	}
+
+	hello := WatchHello{Match: q.Get("match")}
+	if users := q.Get("users"); users != "" {
+		hello.Users = strings.Split(users, ",")
+	}
+	if events := q.Get("events"); events != "" {
+		hello.Events = strings.Split(events, ",")
+	}
+	filter, err := watchFilterNew(hello)
+	if err != nil {
+		dashError(w, http.StatusBadRequest, err)
+		return
+	}
+	amount, _ := strconv.Atoi(q.Get("amount"))
+
+	conn, err := d.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	d.cfg.watchAdd(watch)
+	defer d.cfg.watchRemove(watch.id)
+
+	// The browser closing the socket stops the watcher.
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				watch.Stop()
+				return
+			}
+		}
+	}()
+
+	watch.stream(amount, filter, func(ev WatchEvent) error {
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteJSON(ev)
+	})
+}
+
+// dashRespond writes the result of a handler, or its error with a fitting status.
+func dashRespond(w http.ResponseWriter, v interface{}, err error) {
+	switch err {
+	case nil:
+		dashJSON(w, v)
+	case ErrDashNotFound, mgo.ErrNotFound, ErrScriptNotFound, ErrAllianceNotFound:
+		dashError(w, http.StatusNotFound, err)
+	case ErrDashMethod:
+		dashError(w, http.StatusMethodNotAllowed, err)
+	case ErrBadPermissions:
+		dashError(w, http.StatusForbidden, err)
+	default:
+		dashError(w, http.StatusBadRequest, err)
+	}
+}
+
+// dashDecode reads a JSON request body.
+func dashDecode(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, dashBodyMax)).Decode(v); err != nil {
+		return errors.New("bad request body: " + err.Error())
+	}
+	return nil
+}
+
+// dashJSON writes a JSON response.
+func dashJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// dashError writes a JSON error response.
+func dashError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// dashLoginHTML is the login page of the dashboard.
+const dashLoginHTML = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>SchiNET Dashboard</title>
+<style>body{font-family:sans-serif;background:#2f3136;color:#dcddde;display:flex;justify-content:center;margin-top:15vh}
+form{background:#36393f;padding:2em;border-radius:6px}input{display:block;margin:.5em 0;padding:.4em;width:16em}
+#failed{color:#f04747;display:none}</style></head>
+<body><form method="post" action="/login"><h2>SchiNET</h2><p id="failed">Login failed.</p>
+<input name="user" placeholder="User" autofocus><input name="password" type="password" placeholder="Password">
+<input type="submit" value="Login"></form>
+<script>if(location.search==="?failed")document.getElementById("failed").style.display="block";</script></body></html>
+`
+
+// dashHTML is the dashboard, it talks to the JSON endpoints and the WatchLog socket.
+const dashHTML = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>SchiNET Dashboard</title>
+<style>body{font-family:sans-serif;background:#2f3136;color:#dcddde;margin:0}
+header{background:#202225;padding:.6em 1em;display:flex;gap:1em;align-items:center}
+main{display:flex;height:calc(100vh - 3em)}#feed{flex:1;overflow-y:auto;padding:.5em;font-family:monospace;white-space:pre-wrap}
+#admin{width:40em;overflow-y:auto;padding:.5em;background:#36393f}table{width:100%;border-collapse:collapse}
+td,th{border-bottom:1px solid #4f545c;padding:.2em;text-align:left;vertical-align:top}button,input,select{margin:.1em}
+.edit{color:#faa61a}.delete{color:#f04747}.join{color:#43b581}.leave{color:#f04747}.archived{opacity:.6}
+nav button.on{background:#7289da;color:#fff}#err{color:#f04747}</style></head>
+<body><header><b>SchiNET</b><select id="guild"></select><select id="channel"></select>
+<input id="match" placeholder="Regex filter"><input id="users" placeholder="Users, comma separated">
+<button onclick="watch()">Watch</button><form method="post" action="/logout" style="margin-left:auto"><button>Logout</button></form></header>
+<main><div id="feed"></div><div id="admin"><nav></nav><p id="err"></p><div id="panel"></div></div></main>
+<script>
+var guilds=[],sock=null,tab="config";
+var tabs=["config","aliases","events","tickets","bans"];
+function $(id){return document.getElementById(id)}
+function enc(s){return encodeURIComponent(s).replace(/'/g,"%27")}
+function esc(s){var d=document.createElement("div");d.textContent=s==null?"":String(s);
+  return d.innerHTML.replace(/"/g,"&quot;").replace(/'/g,"&#39;")}
+function gid(){return $("guild").value}
+function api(method,path,body){
+  var opt={method:method,headers:{"Content-Type":"application/json"},credentials:"same-origin"};
+  if(body!==undefined)opt.body=JSON.stringify(body);
+  return fetch("/api/guild/"+gid()+path,opt).then(function(r){return r.json().then(function(j){
+    if(!r.ok)throw new Error(j.error);$("err").textContent="";return j})}).catch(function(e){$("err").textContent=e.message;throw e});
+}
+function load(){fetch("/api/guilds").then(function(r){return r.json()}).then(function(g){
+  guilds=g;$("guild").innerHTML=g.map(function(x){return "<option value='"+esc(x.ID)+"'>"+esc(x.Name)+"</option>"}).join("");
+  channels();show(tab)})}
+function channels(){var g=guilds.filter(function(x){return x.ID===gid()})[0]||{};
+  $("channel").innerHTML="<option value=''>All channels</option>"+(g.Channels||[]).map(function(c){
+    return "<option value='"+esc(c.ID)+"'>#"+esc(c.Name)+"</option>"}).join("")}
+$("guild").onchange=function(){channels();show(tab)};
+function watch(){
+  if(sock)sock.close();$("feed").innerHTML="";
+  var q="guild="+encodeURIComponent(gid())+"&channel="+encodeURIComponent($("channel").value)+"&amount=50"+
+    "&match="+encodeURIComponent($("match").value)+"&users="+encodeURIComponent($("users").value);
+  sock=new WebSocket((location.protocol==="https:"?"wss://":"ws://")+location.host+"/api/watch?"+q);
+  sock.onmessage=function(m){var ev=JSON.parse(m.data),f=$("feed"),d=document.createElement("div");
+    var who=ev.username?"["+ev.username+"#"+ev.discriminator+"] ":"";
+    d.className=ev.type+(ev.archived?" archived":"");
+    d.textContent=new Date(ev.time).toLocaleTimeString()+" "+(ev.channel_name?"#"+ev.channel_name+" ":"")+
+      (ev.type==="message"||ev.type==="hello"||ev.type==="closed"?"":"("+ev.type+") ")+who+(ev.content||"")+
+      (ev.attachments?" "+ev.attachments.join(" "):"");
+    var bottom=f.scrollTop+f.clientHeight>=f.scrollHeight-5;f.appendChild(d);if(bottom)f.scrollTop=f.scrollHeight};
+  sock.onerror=function(){$("err").textContent="WatchLog connection failed."};
+}
+function show(t){tab=t;
+  document.querySelector("nav").innerHTML=tabs.map(function(x){
+    return "<button class='"+(x===t?"on":"")+"' onclick='show(\""+x+"\")'>"+x+"</button>"}).join("");
+  panels[t]()}
+function table(head,rows){return "<table><tr>"+head.map(function(h){return "<th>"+h+"</th>"}).join("")+"</tr>"+
+  rows.map(function(r){return "<tr>"+r.map(function(c){return "<td>"+c+"</td>"}).join("")+"</tr>"}).join("")+"</table>"}
+var panels={
+  config:function(){api("GET","/config").then(function(c){$("panel").innerHTML=
+    "<p>"+esc(c.Name)+" ("+esc(c.ID)+")</p>Prefix: <input id='prefix'>"+
+    "<button onclick='api(\"POST\",\"/config\",{Prefix:$(\"prefix\").value}).then(panels.config)'>Save</button>";
+    $("prefix").value=c.Prefix})},
+  aliases:function(){api("GET","/aliases").then(function(a){$("panel").innerHTML=
+    table(["Caller","Linked","Added by",""],a.map(function(x){return [esc(x.Caller),esc(x.Linked),esc(x.AddedBy.Name),
+      "<button onclick='api(\"DELETE\",\"/aliases?caller="+enc(x.Caller)+"\").then(panels.aliases)'>Remove</button>"]}))+
+    "<p><input id='caller' placeholder='Caller'><input id='linked' placeholder='Linked command'>"+
+    "<button onclick='api(\"POST\",\"/aliases\",{Caller:$(\"caller\").value,Linked:$(\"linked\").value}).then(panels.aliases)'>Add</button></p>"})},
+  events:function(){api("GET","/events").then(function(e){$("panel").innerHTML=
+    table(["Day","Time","Description","Protected",""],e.map(function(x){return [esc(x.Day),esc(x.HHMM),esc(x.Description),x.Protected?"yes":"",
+      "<button onclick='api(\"DELETE\",\"/events?day="+enc(x.Day)+"&hhmm="+enc(x.HHMM)+"\").then(panels.events)'>Remove</button>"]}))+
+    "<p><input id='evday' placeholder='Day (monday)'><input id='evtime' placeholder='HH:MM'><input id='evdesc' placeholder='Description'>"+
+    "<label><input id='evprot' type='checkbox'>Protected</label>"+
+    "<button onclick='api(\"POST\",\"/events\",{Day:$(\"evday\").value,HHMM:$(\"evtime\").value,Description:$(\"evdesc\").value,Protected:$(\"evprot\").checked}).then(panels.events)'>Add</button></p>"})},
+  tickets:function(){api("GET","/tickets").then(function(t){$("panel").innerHTML=
+    table(["ID","Status","Title","Comment","Notes",""],t.map(function(x){return [x.TicketID,x.Open?"Open":(x.Removed?"Removed":"Closed"),
+      esc(x.Title),esc(x.Comment),(x.Notes||[]).map(esc).join("<br>"),
+      "<button onclick='api(\"POST\",\"/tickets\",{TicketID:"+x.TicketID+",Open:"+(!x.Open)+"}).then(panels.tickets)'>"+(x.Open?"Close":"Reopen")+"</button>"+
+      "<button onclick='var n=prompt(\"Note\");if(n)api(\"POST\",\"/tickets\",{TicketID:"+x.TicketID+",Note:n}).then(panels.tickets)'>Note</button>"]}))})},
+  bans:function(){api("GET","/bans").then(function(b){$("panel").innerHTML=
+    table(["User","ID",""],b.map(function(x){return [esc(x.Name+"#"+x.Discriminator),esc(x.ID),
+      "<button onclick='api(\"DELETE\",\"/bans?user="+enc(x.ID)+"\").then(panels.bans)'>Unban</button>"]}))+
+    "<p><input id='banid' placeholder='User ID'><button onclick='api(\"POST\",\"/bans?user=\"+encodeURIComponent($(\"banid\").value)).then(panels.bans)'>Ban</button></p>"})}
+};
+load();
+</script></body></html>
+`
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/pborman/getopt/v2"
+)
+
+// Audit log actions of deleted messages.
+const (
+	auditMessageDelete     = 72
+	auditMessageBulkDelete = 73
+)
+
+// auditDelay gives Discord time to write the audit log after a deletion.
+const auditDelay = 2 * time.Second
+
+// auditWindow is how old a new audit log entry can be and still be for a deletion.
+const auditWindow = 5 * time.Minute
+
+// auditsMax is how many audit log entries are remembered before starting over.
+const auditsMax = 1000
+
+// discordEpoch is the first millisecond of Discord's IDs.
+const discordEpoch = 1420070400000
+
+// auditEntry is an entry of a guild's audit log.
+type auditEntry struct {
+	ID       string `json:"id"`
+	UserID   string `json:"user_id"`   // Who performed the action.
+	TargetID string `json:"target_id"` // Author of deleted messages, the channel for bulk deletes.
+	Options  struct {
+		ChannelID string `json:"channel_id"`
+		Count     string `json:"count"` // Deletions of the same author are counted on one entry.
+	} `json:"options"`
+}
+
+// auditLog is the response for the audit log, discordgo doesn't have it yet.
+type auditLog struct {
+	Entries []auditEntry      `json:"audit_log_entries"`
+	Users   []*discordgo.User `json:"users"`
+}
+
+// messageDeleteBulkHandler records messages deleted together, such as by ,clear.
+func (cfg *Config) messageDeleteBulkHandler(s *discordgo.Session, mdb *discordgo.MessageDeleteBulk) {
+	for _, id := range mdb.Messages {
+		if err := cfg.allianceDelete(id); err != nil {
+			fmt.Println("Deleting alliance relays: " + err.Error())
+		}
+	}
+	cfg.messageDeleted(mdb.ChannelID, mdb.Messages, true)
+}
+
+// messageDeleted marks messages as deleted in the archive and tells the
+// WatchLogs. Who deleted them is added from the audit log once it is written.
+func (cfg *Config) messageDeleted(channelID string, ids []string, bulk bool) {
+	// Channels not known are private.
+	var database, guildName = "private", "private"
+	if c := cfg.Core.GetChannel(channelID); c != nil {
+		database = c.GuildID
+		if g := cfg.Core.GetGuild(c.GuildID); g != nil {
+			guildName = g.Name
+		}
+	}
+
+	var now = time.Now()
+	var deleted []Message
+	for _, id := range ids {
+		// Handle potential WatchLogs, with what was last known of the message.
+		var msg = Message{ID: id, ChannelID: channelID}
+		if err := msg.Get(database); err != nil && err != mgo.ErrNotFound {
+			fmt.Println("Getting deleted message: " + err.Error())
+		} else if err == nil {
+			if err = msg.deletedSet(database, now, nil); err != nil {
+				fmt.Println("Marking message deleted: " + err.Error())
+			}
+			deleted = append(deleted, msg)
+		}
+
+		ev := watchEventNew(watchDelete, database, guildName, &msg)
+		ev.Time = now
+		cfg.watchLogHandler(ev)
+	}
+
+	if database == "private" || len(deleted) == 0 {
+		return
+	}
+
+	// Deletions are found on the audit log by author, or by channel when bulk.
+	var target, action = deleted[0].Author.ID, auditMessageDelete
+	if bulk {
+		target, action = channelID, auditMessageBulkDelete
+	}
+
+	go func() {
+		time.Sleep(auditDelay)
+		by, ok := cfg.auditDeleter(database, channelID, target, action)
+		if !ok {
+			return
+		}
+
+		for _, msg := range deleted {
+			if err := msg.deletedSet(database, now, &by); err != nil {
+				fmt.Println("Marking message deleted: " + err.Error())
+			}
+		}
+	}()
+}
+
+// deletedSet records when a message was deleted, and by whom if known.
+func (m *Message) deletedSet(database string, when time.Time, by *UserBasic) error {
+	var set = bson.M{"deleted": when}
+	if by != nil {
+		set["deletedby"] = *by
+	}
+
+	q := bson.M{"id": m.ID}
+	c := bson.M{"$set": set}
+	db := DBdataCreate(database, CollectionMessages, m, q, c)
+	return db.dbEdit(Message{})
+}
+
+// auditDeleter finds who deleted a message from the audit log. Authors deleting
+// their own messages aren't logged, so nothing is found for those. Deletions
+// of the same author are counted on one entry, so an entry is a match if it
+// is new or its count went up since it was last seen.
+func (cfg *Config) auditDeleter(guildID, channelID, targetID string, action int) (UserBasic, bool) {
+	url := fmt.Sprintf("%s/audit-logs?action_type=%d&limit=25", discordgo.EndpointGuild(guildID), action)
+	body, err := cfg.Core.Session.RequestWithBucketID("GET", url, nil, discordgo.EndpointGuild(guildID)+"/audit-logs")
+	if err != nil {
+		// Missing the permission to view the audit log is common, leave it unknown.
+		return UserBasic{}, false
+	}
+
+	var log auditLog
+	if err = json.Unmarshal(body, &log); err != nil {
+		return UserBasic{}, false
+	}
+
+	cfg.auditsMu.Lock()
+	defer cfg.auditsMu.Unlock()
+	if cfg.audits == nil || len(cfg.audits) > auditsMax {
+		cfg.audits = make(map[string]int)
+	}
+
+	var found *auditEntry
+	for n, e := range log.Entries {
+		count, _ := strconv.Atoi(e.Options.Count)
+		last, seen := cfg.audits[e.ID]
+		recent := time.Since(snowflakeTime(e.ID)) < auditWindow
+
+		// Only the entry matched counts one deletion, the others are left for
+		// the deletions they belong to. Older entries seen for the first time
+		// are remembered so later counts have a start.
+		if !seen && !recent {
+			cfg.audits[e.ID] = count
+		}
+
+		if found != nil || e.TargetID != targetID {
+			continue
+		} else if action == auditMessageDelete && e.Options.ChannelID != channelID {
+			continue
+		}
+
+		if (!seen && recent) || (seen && count > last) {
+			found = &log.Entries[n]
+			cfg.audits[e.ID] = last + 1
+		}
+	}
+
+	if found == nil {
+		return UserBasic{}, false
+	}
+	for _, u := range log.Users {
+		if u.ID == found.UserID {
+			return UserBasic{ID: u.ID, Name: u.Username, Discriminator: u.Discriminator}, true
+		}
+	}
+	return UserBasic{ID: found.UserID}, true
+}
+
+// snowflakeTime is when a Discord ID was created.
+func snowflakeTime(id string) time.Time {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	ms := (n >> 22) + discordEpoch
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond))
+}
+
+// CoreDeleted lists the messages recently deleted in a channel.
+func (dat *IOdata) CoreDeleted() error {
+	// Return if the user does not have the role
+	if ok := dat.user.HasRoleType(dat.guildConfig, rolePermissionMod); !ok {
+		return ErrBadPermissions
+	}
+
+	var help bool
+	var channel string
+	var limit = 5
+
+	fl := getopt.New()
+	fl.FlagLong(&channel, "channel", 'c', "Channel to look in, #mention or name. Default: this one")
+	fl.FlagLong(&limit, "limit", 'l', "How many messages to show, up to 10")
+	fl.FlagLong(&help, "help", 'h', "This message")
+
+	if err := fl.Getopt(dat.io, nil); err != nil {
+		return err
+	}
+	if help {
+		dat.output = Help(fl, "", "")
+		return nil
+	}
+
+	var channelID = dat.msg.ChannelID
+	if channel != "" {
+		channelID = searchChannel(dat.guild.ID, channel)
+	}
+	if limit < 1 || limit > 10 {
+		limit = 5
+	}
+
+	var q = bson.M{"channelid": channelID, "deleted": bson.M{"$gt": time.Time{}}}
+	dbdat := DBdataCreate(dat.guild.ID, CollectionMessages, Message{}, q, nil)
+	if err := dbdat.dbGetWithLimit(Message{}, []string{"-deleted"}, limit); err != nil {
+		return err
+	} else if len(dbdat.Documents) == 0 {
+		return errors.New("no deleted messages found")
+	}
+
+	var msg string
+	for _, d := range dbdat.Documents {
+		m := d.(Message)
+		by := "unknown, likely the author"
+		if m.DeletedBy.ID != "" {
+			by = m.DeletedBy.Name
+		}
+
+		content := strings.Replace(m.Content, "\n", " ", -1)
+		if r := []rune(content); len(r) > 100 {
+			content = string(r[:97]) + "..."
+		}
+		msg += fmt.Sprintf("**%s**, sent %s, deleted %s by %s\n%s\n\n", m.Author.Name,
+			m.Timestamp.Format("2006-01-02 15:04"), m.Deleted.Format("2006-01-02 15:04"), by, content)
+	}
+
+	dat.msgEmbed = embedCreator(msg, ColorYellow)
+	dat.msgEmbed.Title = "Recently deleted messages"
+	return nil
+}
@@ -2,11 +2,9 @@ package main
 
 import (
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
-	"github.com/d0x1p2/godbot"
 	mgo "gopkg.in/mgo.v2"
 )
 
@@ -213,6 +211,9 @@ func (conf *Config) guildMemberAddHandler(s *discordgo.Session, nu *discordgo.Gu
 	msg := fmt.Sprintf("Welcome to the server, __**%s**#%s__!", nu.User.Username, nu.User.Discriminator)
 	s.ChannelMessageSendEmbed(c.ID, embedCreator(msg, ColorBlue))
 
+	// Handle potential WatchLogs
+	conf.watchLogHandler(conf.watchEventMember(watchJoin, nu.GuildID, nu.User))
+
 	tn := time.Now()
 	// Add the new user to the database.
 	if err := UserUpdateSimple(nu.User, 0, tn); err != nil {
@@ -262,6 +263,9 @@ func (conf *Config) guildMemberUpdateHandler(s *discordgo.Session, uu *discordgo
 
 // guildMemberRemoveHandler notifies of a leaving user (NOT CURRENTLY WORKING)
 func (conf *Config) guildMemberRemoveHandler(s *discordgo.Session, du *discordgo.GuildMemberRemove) {
+	// Handle potential WatchLogs
+	conf.watchLogHandler(conf.watchEventMember(watchLeave, du.GuildID, du.User))
+
 	for _, c := range conf.Core.Channels {
 		if c.Name == "internal" && c.GuildID == du.GuildID {
 			tn := time.Now()
@@ -327,44 +331,24 @@ func (conf *Config) channelDeleteHandler(s *discordgo.Session, cd *discordgo.Cha
 	return
 }
 
-// watchLogHandler tracks if the message is under WatchLog.
-func (conf *Config) watchLogHandler(guild *godbot.Guild, msg *discordgo.MessageCreate, channel string) {
-	// TAG: TODO - account for watched servers that have same guild, but not same channel.
-	// Verify we have a watchlogger on this guild.
-	var guildID string
-	var watched WatchLog
-	// Check if private messages are being WatchLogged.
-	if guild == nil && channel == "private" {
-		guildID = "private"
-		channel = ""
-	} else if guild == nil {
-		// Guild is nil, return to prevent accessing nil memory.
+// messageReactionAddHandler records votes made on polls with reactions.
+func (conf *Config) messageReactionAddHandler(s *discordgo.Session, ra *discordgo.MessageReactionAdd) {
+	if ra.UserID == conf.Core.User.ID {
 		return
-	} else {
-		guildID = guild.ID
 	}
 
-	// Cycle thru our WatchLogs.
-	for _, w := range conf.watched {
-		if w.guildID == guildID {
-			watched = w
-			break
-		}
+	if err := pollReaction(s, ra.MessageReaction, true); err != nil {
+		fmt.Println("Recording poll vote: " + err.Error())
 	}
+}
 
-	// Return since guild ID isn't being watched.
-	if watched.guildID == "" {
+// messageReactionRemoveHandler removes votes made on polls with reactions.
+func (conf *Config) messageReactionRemoveHandler(s *discordgo.Session, rr *discordgo.MessageReactionRemove) {
+	if rr.UserID == conf.Core.User.ID {
 		return
 	}
 
-	// If this isn't the correct channel, return.
-	if strings.ToLower(watched.channelName) != strings.ToLower(channel) && !watched.channelAll {
-		return
+	if err := pollReaction(s, rr.MessageReaction, false); err != nil {
+		fmt.Println("Removing poll vote: " + err.Error())
 	}
-
-	// Create output.
-	output := watched.MessageCreate(msg.Author.Username, msg.Author.Discriminator, channel, msg.ContentWithMentionsReplaced())
-
-	// Send the composed message.
-	watched.Talk(output)
 }
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Constants for the IRC bridge.
+const (
+	ircRetryMin  = 5 * time.Second // Wait before the first reconnect.
+	ircRetryMax  = 5 * time.Minute // Longest wait between reconnects.
+	ircLineMax   = 400             // Bytes of text sent per line, leaves room for the prefix.
+	ircTimeout   = 5 * time.Minute // Connection is considered dead without any traffic.
+	ircNickRetry = "_"             // Appended to the nick when it is taken.
+	ircLineDelay = time.Second     // Lines are sent this far apart after a burst,
+	ircBurst     = 5               // of this many, to stay under flood limits.
+)
+
+// Regular expressions converting Discord's markup for IRC.
+var (
+	ircChannelMention = regexp.MustCompile(`<#[0-9]+>`)
+	ircEmoji          = regexp.MustCompile(`<a?(:[A-Za-z0-9_]+:)[0-9]+>`)
+	ircAddress        = regexp.MustCompile(`^@?([A-Za-z0-9_\-\[\]\\^{}|` + "`" + `]+)[:,]\s`)
+)
+
+// IRCEndpoint is an IRC channel that is a member of an alliance.
+type IRCEndpoint struct {
+	Server  string // host:port
+	Channel string // #channel
+	Nick    string
+	TLS     bool
+}
+
+// ircUnsafe are the characters that end or break an IRC line.
+const ircUnsafe = "\r\n\x00"
+
+// ircClean takes what would end a line out of one being written.
+var ircClean = strings.NewReplacer("\r", " ", "\n", " ", "\x00", "")
+
+// ircNick matches the nicks servers accept.
+var ircNick = regexp.MustCompile("^[A-Za-z\\[\\]\\\\`_^{|}][A-Za-z0-9\\[\\]\\\\`_^{|}-]{0,29}$")
+
+// ircClient is a connection to an IRC server joined to a single channel, it
+// reconnects until closed.
+type ircClient struct {
+	IRCEndpoint
+	recv func(nick, text string) // Called for each message in the channel.
+
+	mu     sync.Mutex
+	conn   net.Conn
+	nick   string    // Nick currently in use.
+	sent   time.Time // When the last line queued by Say goes out.
+	joined bool
+	closed bool
+}
+
+// ircParse parses an endpoint such as "irc.example.net:6697/#channel".
+func ircParse(str, nick string, useTLS bool) (*IRCEndpoint, error) {
+	parts := strings.SplitN(str, "/", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[1], "#") || parts[0] == "" {
+		return nil, errors.New("IRC endpoints look like: irc.example.net:6667/#channel")
+	}
+
+	server := parts[0]
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		port := "6667"
+		if useTLS {
+			port = "6697"
+		}
+		server = net.JoinHostPort(server, port)
+	}
+
+	if nick == "" {
+		nick = "SchiNET"
+	}
+
+	// They are written into commands, anything that could end one is refused.
+	if strings.ContainsAny(server, ircUnsafe+" ") {
+		return nil, errors.New("that isn't an IRC server")
+	} else if strings.ContainsAny(parts[1], ircUnsafe+" ,\x07") {
+		return nil, errors.New("IRC channels can't contain spaces, commas or control characters")
+	} else if !ircNick.MatchString(nick) {
+		return nil, errors.New("IRC nicks are letters, numbers and []\\`_^{|}-, up to 30 long, not starting with a number or '-'")
+	}
+	return &IRCEndpoint{Server: server, Channel: parts[1], Nick: nick, TLS: useTLS}, nil
+}
+
+// ID is how the endpoint is identified as a member of an alliance.
+func (e *IRCEndpoint) ID() string {
+	return "irc:" + e.Server + "/" + e.Channel
+}
+
+// String is the readable name of the endpoint.
+func (e *IRCEndpoint) String() string {
+	return "IRC " + e.Channel + "@" + e.Server
+}
+
+// ircClientNew creates a client and starts connecting.
+func ircClientNew(e IRCEndpoint, recv func(nick, text string)) *ircClient {
+	c := &ircClient{IRCEndpoint: e, recv: recv, nick: e.Nick}
+	go c.run()
+	return c
+}
+
+// run keeps the client connected until it is closed.
+func (c *ircClient) run() {
+	retry := ircRetryMin
+	for {
+		start := time.Now()
+		err := c.connect()
+
+		c.mu.Lock()
+		closed := c.closed
+		c.conn = nil
+		c.joined = false
+		c.mu.Unlock()
+		if closed {
+			return
+		}
+
+		// Connections that lasted a while start the backoff again.
+		if time.Since(start) > ircRetryMax {
+			retry = ircRetryMin
+		}
+		fmt.Printf("IRC %s disconnected, retrying in %s: %v\n", c.Server, retry, err)
+		time.Sleep(retry)
+		if retry *= 2; retry > ircRetryMax {
+			retry = ircRetryMax
+		}
+	}
+}
+
+// connect opens a connection and reads from it until it fails.
+func (c *ircClient) connect() error {
+	var conn net.Conn
+	var err error
+	if c.TLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", c.Server, nil)
+	} else {
+		conn, err = net.DialTimeout("tcp", c.Server, 30*time.Second)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.conn = conn
+	c.nick = c.Nick
+	c.mu.Unlock()
+
+	c.write("NICK " + c.Nick)
+	c.write("USER " + c.Nick + " 0 * :SchiNET alliance bridge")
+
+	r := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(ircTimeout))
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		c.handle(strings.TrimRight(line, "\r\n"))
+	}
+}
+
+// handle processes a line from the server.
+func (c *ircClient) handle(line string) {
+	var prefix string
+	if strings.HasPrefix(line, ":") {
+		n := strings.Index(line, " ")
+		if n < 0 {
+			return
+		}
+		prefix, line = line[1:n], line[n+1:]
+	}
+
+	var trailing string
+	if n := strings.Index(line, " :"); n >= 0 {
+		line, trailing = line[:n], line[n+2:]
+	}
+	params := strings.Fields(line)
+	if len(params) == 0 {
+		return
+	}
+
+	switch params[0] {
+	case "PING":
+		// The token is usually trailing, but "PING token" is allowed too.
+		token := trailing
+		if token == "" && len(params) > 1 {
+			token = params[1]
+		}
+		c.write("PONG :" + token)
+	case "001":
+		// Registered, join the channel.
+		c.write("JOIN " + c.Channel)
+	case "433":
+		// Nick is in use.
+		c.mu.Lock()
+		c.nick += ircNickRetry
+		nick := c.nick
+		c.mu.Unlock()
+		c.write("NICK " + nick)
+	case "JOIN":
+		if strings.SplitN(prefix, "!", 2)[0] == c.currentNick() {
+			c.mu.Lock()
+			c.joined = true
+			c.mu.Unlock()
+		}
+	case "KICK":
+		// Rejoin if kicked.
+		if len(params) > 2 && params[2] == c.currentNick() {
+			c.mu.Lock()
+			c.joined = false
+			c.mu.Unlock()
+			c.write("JOIN " + c.Channel)
+		}
+	case "PRIVMSG":
+		if len(params) < 2 || !strings.EqualFold(params[1], c.Channel) {
+			return
+		}
+		nick := strings.SplitN(prefix, "!", 2)[0]
+		if nick == c.currentNick() || nick == "" {
+			return
+		}
+
+		// Actions are sent as CTCP.
+		if strings.HasPrefix(trailing, "\x01ACTION ") {
+			trailing = "_" + strings.Trim(strings.TrimPrefix(trailing, "\x01ACTION "), "\x01") + "_"
+		} else if strings.HasPrefix(trailing, "\x01") {
+			return
+		}
+		c.recv(nick, trailing)
+	}
+}
+
+// currentNick gets the nick in use.
+func (c *ircClient) currentNick() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nick
+}
+
+// write sends a raw line to the server.
+func (c *ircClient) write(line string) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return errors.New("not connected to " + c.Server)
+	}
+
+	// A line break in relayed text would start a command of its own.
+	line = ircClean.Replace(line)
+
+	conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	_, err := conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+// Say sends text to the channel, split into lines the server accepts.
+func (c *ircClient) Say(text string) error {
+	c.mu.Lock()
+	joined := c.joined
+	c.mu.Unlock()
+	if !joined {
+		return errors.New("not in " + c.Channel + " on " + c.Server)
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		for _, part := range ircSplit(line, ircLineMax) {
+			c.pace()
+			if err := c.write("PRIVMSG " + c.Channel + " :" + part); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pace waits for the next line to be allowed out. A burst of lines is sent at
+// once, then they are spaced out so the server doesn't kick for flooding.
+func (c *ircClient) pace() {
+	c.mu.Lock()
+	tn := time.Now()
+	if earliest := tn.Add(-ircBurst * ircLineDelay); c.sent.Before(earliest) {
+		c.sent = earliest
+	}
+	c.sent = c.sent.Add(ircLineDelay)
+	wait := c.sent.Sub(tn)
+	c.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// ircSplit cuts a line into pieces of at most max bytes, without splitting
+// a character.
+func ircSplit(line string, max int) []string {
+	var parts []string
+	for len(line) > max {
+		n := max
+		for n > 0 && !utf8.RuneStart(line[n]) {
+			n--
+		}
+		if n == 0 {
+			// Not UTF-8, cut where it's needed.
+			n = max
+		}
+		parts = append(parts, line[:n])
+		line = line[n:]
+	}
+	return append(parts, line)
+}
+
+// Close disconnects and stops reconnecting.
+func (c *ircClient) Close() {
+	c.mu.Lock()
+	c.closed = true
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn != nil {
+		conn.Write([]byte("QUIT :Alliance bridge closed\r\n"))
+		conn.Close()
+	}
+}
+
+// ircStart connects the IRC members of an alliance that aren't connected.
+func (cfg *Config) ircStart(ally *Alliance) {
+	cfg.ircMu.Lock()
+	defer cfg.ircMu.Unlock()
+	if cfg.irc == nil {
+		cfg.irc = make(map[string]*ircClient)
+	}
+
+	for _, m := range ally.Members {
+		if m.IRC == nil || cfg.irc[m.ChannelID] != nil {
+			continue
+		}
+		name, channelID := ally.Name, m.ChannelID
+		cfg.irc[channelID] = ircClientNew(*m.IRC, func(nick, text string) {
+			if err := cfg.ircReceive(name, channelID, nick, text); err != nil {
+				fmt.Println("Relaying from IRC: " + err.Error())
+			}
+		})
+	}
+}
+
+// ircStop disconnects an IRC member.
+func (cfg *Config) ircStop(channelID string) {
+	cfg.ircMu.Lock()
+	defer cfg.ircMu.Unlock()
+	if c := cfg.irc[channelID]; c != nil {
+		c.Close()
+		delete(cfg.irc, channelID)
+	}
+}
+
+// ircSend relays a message from the alliance to an IRC member.
+func (cfg *Config) ircSend(member *Channel, username, content string, attachments []*discordgo.MessageAttachment) error {
+	cfg.ircMu.Lock()
+	c := cfg.irc[member.ChannelID]
+	cfg.ircMu.Unlock()
+	if c == nil {
+		return errors.New("no connection for " + member.GuildName)
+	}
+
+	var text = ircFormat(cfg.Core.Session, content)
+	for _, a := range attachments {
+		text += "\n" + a.URL
+	}
+
+	var lines []string
+	for _, ln := range strings.Split(strings.TrimSpace(text), "\n") {
+		lines = append(lines, "<"+username+"> "+ln)
+	}
+	return c.Say(strings.Join(lines, "\n"))
+}
+
+// ircReceive relays a message from an IRC member to the rest of the alliance,
+// under the rules of the guild that bridged the channel.
+func (cfg *Config) ircReceive(name, channelID, nick, text string) error {
+	ally := cfg.AllianceGet(name)
+	if ally == nil {
+		return nil
+	}
+	n := ally.Channel(channelID)
+	if n < 0 {
+		return nil
+	}
+
+	source := &ally.Members[n]
+	if g := ally.Member(source.GuildID); g >= 0 {
+		source = &ally.Members[g]
+	}
+
+	// "nick: hello" addresses a user, make it a mention Discord understands.
+	text = ircAddress.ReplaceAllString(text, "@$1 ")
+
+	m := &discordgo.Message{
+		ChannelID: channelID,
+		Content:   text,
+		Author:    &discordgo.User{ID: "irc:" + nick, Username: nick},
+	}
+	return cfg.allianceFrom(name, source, m)
+}
+
+// ircFormat converts Discord's mentions and emojis to plain text for IRC.
+func ircFormat(s *discordgo.Session, text string) string {
+	text = allianceMention.ReplaceAllStringFunc(text, func(mention string) string {
+		if strings.HasPrefix(mention, "<@&") {
+			return "@role"
+		}
+		u := UserNew(nil)
+		if err := u.Get(userIDClean(mention)); err != nil {
+			return "@unknown"
+		}
+		return u.Username
+	})
+
+	text = ircChannelMention.ReplaceAllStringFunc(text, func(mention string) string {
+		if ch, err := s.State.Channel(strings.Trim(mention, "<#>")); err == nil {
+			return "#" + ch.Name
+		}
+		return "#unknown"
+	})
+
+	return ircEmoji.ReplaceAllString(text, "$1")
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// ircServer is a fake IRC server accepting a single client.
+type ircServer struct {
+	t    *testing.T
+	ln   net.Listener
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func ircServerNew(t *testing.T) *ircServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ircServer{t: t, ln: ln}
+}
+
+// accept waits for the client to connect.
+func (s *ircServer) accept() {
+	s.ln.(*net.TCPListener).SetDeadline(time.Now().Add(5 * time.Second))
+	conn, err := s.ln.Accept()
+	if err != nil {
+		s.t.Fatal("client didn't connect: ", err)
+	}
+	s.conn = conn
+	s.r = bufio.NewReader(conn)
+}
+
+// expect reads the next line from the client and checks its start.
+func (s *ircServer) expect(prefix string) string {
+	s.t.Helper()
+	s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := s.r.ReadString('\n')
+	if err != nil {
+		s.t.Fatalf("expected %q: %s", prefix, err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, prefix) {
+		s.t.Fatalf("expected %q, got %q", prefix, line)
+	}
+	return line
+}
+
+// send writes a line to the client.
+func (s *ircServer) send(line string) {
+	s.t.Helper()
+	if _, err := s.conn.Write([]byte(line + "\r\n")); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func (s *ircServer) close() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.ln.Close()
+}
+
+// ircWaitJoined waits for the client to see itself join the channel.
+func ircWaitJoined(t *testing.T, c *ircClient) {
+	t.Helper()
+	for end := time.Now().Add(5 * time.Second); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		c.mu.Lock()
+		joined := c.joined
+		c.mu.Unlock()
+		if joined {
+			return
+		}
+	}
+	t.Fatal("client never joined the channel")
+}
+
+func TestIRCClient(t *testing.T) {
+	s := ircServerNew(t)
+	defer s.close()
+
+	recv := make(chan string, 1)
+	e := IRCEndpoint{Server: s.ln.Addr().String(), Channel: "#bridge", Nick: "schinet"}
+	c := ircClientNew(e, func(nick, text string) {
+		recv <- nick + ": " + text
+	})
+	defer c.Close()
+
+	// Registration, with the nick taken at first.
+	s.accept()
+	s.expect("NICK schinet")
+	s.expect("USER schinet ")
+	s.send(":irc.test 433 * schinet :Nickname is already in use")
+	s.expect("NICK schinet_")
+	s.send(":irc.test 001 schinet_ :Welcome")
+	s.expect("JOIN #bridge")
+	s.send(":schinet_!bot@host JOIN #bridge")
+	ircWaitJoined(t, c)
+
+	// Pings with and without the token trailing.
+	s.send("PING :irc.test")
+	s.expect("PONG :irc.test")
+	s.send("PING token")
+	s.expect("PONG :token")
+
+	// Messages in the channel are relayed, the bot's own and other channels aren't.
+	s.send(":schinet_!bot@host PRIVMSG #bridge :echo")
+	s.send(":alice!a@host PRIVMSG #other :elsewhere")
+	s.send(":alice!a@host PRIVMSG #bridge :hello there")
+	select {
+	case got := <-recv:
+		if got != "alice: hello there" {
+			t.Fatalf("relayed %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message wasn't relayed")
+	}
+
+	s.send(":alice!a@host PRIVMSG #bridge :\x01ACTION waves\x01")
+	select {
+	case got := <-recv:
+		if got != "alice: _waves_" {
+			t.Fatalf("relayed action as %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("action wasn't relayed")
+	}
+
+	// Text sent to the channel is split into lines, blank ones are dropped.
+	if err := c.Say("first\n\nsecond"); err != nil {
+		t.Fatal(err)
+	}
+	s.expect("PRIVMSG #bridge :first")
+	s.expect("PRIVMSG #bridge :second")
+
+	// Carriage returns and NULs can't start commands of their own.
+	if err := c.Say("hi\rPRIVMSG NickServ :IDENTIFY x\x00"); err != nil {
+		t.Fatal(err)
+	}
+	if line := s.expect("PRIVMSG #bridge :hi"); line != "PRIVMSG #bridge :hi PRIVMSG NickServ :IDENTIFY x" {
+		t.Fatalf("sent %q", line)
+	}
+
+	c.Close()
+	s.expect("QUIT")
+}
+
+func TestIRCSplit(t *testing.T) {
+	line := strings.Repeat("é", ircLineMax)
+	parts := ircSplit(line, ircLineMax)
+	if len(parts) != 2 {
+		t.Fatalf("split into %d parts", len(parts))
+	}
+	if strings.Join(parts, "") != line {
+		t.Fatal("parts don't add up to the line")
+	}
+	for _, p := range parts {
+		if len(p) > ircLineMax || !utf8.ValidString(p) {
+			t.Fatalf("bad part of %d bytes", len(p))
+		}
+	}
+
+	if parts = ircSplit("short", ircLineMax); len(parts) != 1 || parts[0] != "short" {
+		t.Fatalf("short line split into %q", parts)
+	}
+}
+
+func TestIRCPace(t *testing.T) {
+	c := &ircClient{}
+	start := time.Now()
+	for n := 0; n < ircBurst; n++ {
+		c.pace()
+	}
+	if time.Since(start) > ircLineDelay/2 {
+		t.Fatal("a burst of lines was held back")
+	}
+
+	c.pace()
+	if time.Since(start) < ircLineDelay/2 {
+		t.Fatal("lines after a burst weren't spaced out")
+	}
+}
+
+func TestIRCParse(t *testing.T) {
+	e, err := ircParse("irc.example.net/#chan", "", true)
+	if err != nil {
+		t.Fatal(err)
+	} else if e.Server != "irc.example.net:6697" || e.Channel != "#chan" || e.Nick != "SchiNET" {
+		t.Fatalf("parsed %+v", e)
+	}
+
+	for _, c := range []struct{ endpoint, nick string }{
+		{"irc.example.net/#chan\rQUIT", "bot"},
+		{"irc.example.net/#a,#b", "bot"},
+		{"irc.example.net/#chan", "bot\r\nQUIT"},
+		{"irc.example.net/#chan", "1bot"},
+		{"irc.example.net\x00/#chan", "bot"},
+	} {
+		if _, err := ircParse(c.endpoint, c.nick, false); err == nil {
+			t.Errorf("accepted %q as %q", c.endpoint, c.nick)
+		}
+	}
+}
@@ -167,6 +167,11 @@ func (lib *Library) Add() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	return lib.Save(txt)
+}
+
+// Save a script's content to the library, adding it or editing the existing one.
+func (lib *Library) Save(txt string) (string, error) {
 	lib.Script.Content = txt
 	lib.Script.Length = len(txt)
 
@@ -1,14 +1,11 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"net"
 	"os"
-	"strconv"
 
 	mgo "gopkg.in/mgo.v2"
 
@@ -18,7 +15,7 @@ import (
 
 // Constants used to initiate and customize bot.
 var (
-	_version       = "0.9.4"
+	_version       = "0.9.5"
 	ConfigFile     ConfigJSON
 	helpDocs       = "https://github.com/d0x1p2/SchiNET/blob/master/docs/README.md"
 	consoleDisable bool   // Argument to run in background or to run as a console.
@@ -26,7 +23,14 @@ var (
 	watcherEnabled bool   // Argument for WatchLog being enabled or disabled.
 	watcherPort    string // Argument for WatchLog Port.
 	watcherHost    string // Argument for WatachLog Host.
+	watcherSocket  string // Argument for WatchLog Unix socket.
+	watcherToken   string // Argument for WatchLog shared secret.
+	watcherUsers   string // Argument for WatchLog users to receive, comma separated.
+	watcherMatch   string // Argument for WatchLog regular expression content must match.
+	watcherEvents  string // Argument for WatchLog event types to receive, comma separated.
+	watcherJSON    bool   // Argument for WatchLog to print the JSON lines received.
 	execute        string // Argument for Execute a command in a new window.
+	executeFile    string // Argument for Execute a script of commands, '-' for stdin.
 	cmds           map[string]map[string]string
 
 	Mgo *mgo.Session // Public access to the MGO drivers.
@@ -38,8 +42,14 @@ func init() {
 	flag.BoolVar(&DEBUG, "debug", false, "Debugging turned on.")
 	flag.StringVar(&watcherPort, "port", "", "Port to connect on for watcher.")
 	flag.StringVar(&watcherHost, "host", "", "Host to the watcher.")
+	flag.StringVar(&watcherSocket, "socket", "", "Unix socket to the watcher.")
+	flag.StringVar(&watcherToken, "token", "", "Token to authenticate with the watcher.")
+	flag.StringVar(&watcherUsers, "users", "", "Users to watch, by ID or name, comma separated.")
+	flag.StringVar(&watcherMatch, "match", "", "Regular expression watched content must match.")
+	flag.StringVar(&watcherEvents, "events", "", "Events to watch: message, edit, delete, join, leave.")
+	flag.BoolVar(&watcherJSON, "json", false, "Print the watcher's events as JSON lines.")
 	flag.StringVar(&execute, "exec", "", "Execute a console command and exit.")
-	flag.Parse()
+	flag.StringVar(&executeFile, "exec-file", "", "Execute a script of commands ('-' for stdin), print the results as JSON and exit.")
 
 	// Init commands.
 	cmds = make(map[string]map[string]string)
@@ -49,6 +59,7 @@ func init() {
 
 	cmds["admin"]["histo"] = "Prints out server message statistics."
 	cmds["admin"]["admin"] = "Allows performing various admin related tasks."
+	cmds["admin"]["archive"] = "Exports archived messages to a paste as JSONL, CSV or HTML."
 	cmds["mod"]["ticket"] = "Modify trouble tickets placed by users."
 
 	cmds["mod"]["abuse"] = "Add a bot abuser to restrict access."
@@ -56,6 +67,9 @@ func init() {
 	cmds["mod"]["alias"] = "Add/Remove command aliases."
 	cmds["mod"]["clear"] = "Clears messages from current channel. Specify a number."
 	cmds["mod"]["ally"] = "Ally another guild."
+	cmds["mod"]["cmd"] = "Add/Edit/Remove custom text commands."
+	cmds["mod"]["search"] = "Search the archived messages of the server."
+	cmds["mod"]["deleted"] = "Lists the messages recently deleted in a channel."
 
 	cmds["normal"]["script"] = "Add/Edit/Remove scripts for the local server."
 	cmds["normal"]["event"] = "View events that are currently scheduled."
@@ -70,6 +84,9 @@ func init() {
 }
 
 func main() {
+	// Parsed here instead of init so the package's tests get their own flags.
+	flag.Parse()
+
 	// Check if our configuration exists. If not create it.
 	ConfigFile = ConfigJSON{}
 	if ok := ConfigFile.Processor(); !ok {
@@ -88,7 +105,8 @@ func main() {
 	// If it is a watcher, just start the client and return once complete.
 	if watcherEnabled {
 		// Return if we don't have the information to connect.
-		if watcherHost == "" || watcherPort == "" {
+		if watcherSocket == "" && (watcherHost == "" || watcherPort == "") {
+			fmt.Println("Watcher needs '-host' and '-port', or '-socket'.")
 			return
 		}
 		clientLaunch()
@@ -116,6 +134,19 @@ func main() {
 		return
 	}
 
+	if executeFile != "" {
+		// The results are the only thing written to stdout.
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+
+		cfg.Core.LiteMode = true
+		if err = cfg.Core.Start(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		cfg.BatchExec(executeFile, stdout)
+	}
+
 	if execute != "" {
 		cfg.Core.LiteMode = true
 		if err = cfg.Core.Start(); err != nil {
@@ -150,12 +181,23 @@ func main() {
 		return
 	}
 
+	// Handlers not provided by godbot: poll votes and deleted messages.
+	cfg.Core.Session.AddHandler(cfg.messageReactionAddHandler)
+	cfg.Core.Session.AddHandler(cfg.messageReactionRemoveHandler)
+	cfg.Core.Session.AddHandler(cfg.messageDeleteHandler)
+	cfg.Core.Session.AddHandler(cfg.messageDeleteBulkHandler)
+
 	// Load all alliances so that servers will be bridged correctly.
 	if err := cfg.AlliancesLoad(); err != nil {
 		fmt.Println(err)
 		cfg.cleanup()
 	}
 
+	// Reschedule the open polls so they close on time.
+	if err := cfg.PollsLoad(); err != nil {
+		fmt.Println("Loading polls: " + err.Error())
+	}
+
 	// Load all guild configurations to remove frequent database access per message.
 	if err = cfg.GuildConfigLoad(); err != nil {
 		fmt.Println(err)
@@ -178,11 +220,11 @@ func main() {
 		if err = g.Update(); err != nil {
 			fmt.Println("Role Correction, updating: " + err.Error())
 		}
+	}
 
-		// Process the default bot command aliases.
-		if err := cfg.defaultAliases(g.ID); err != nil {
-			fmt.Println("Setting default aliases: ", err.Error())
-		}
+	// Process the default bot command aliases.
+	if err := cfg.defaultAliases(); err != nil {
+		fmt.Println("Setting default aliases: ", err.Error())
 	}
 
 	// Member Roles update in Database:
@@ -190,6 +232,11 @@ func main() {
 		fmt.Println("Member Correction: " + err.Error())
 	}
 
+	// Serve the web dashboard if it is configured.
+	if err = cfg.dashboardStart(); err != nil {
+		fmt.Println("Dashboard: " + err.Error())
+	}
+
 	// Run in either silent mode with no output (for background) or with interactive console.
 	if !consoleDisable {
 		cfg.core()
@@ -198,53 +245,27 @@ func main() {
 	}
 }
 
-// cleanup children and stop the bot correctly.
+// cleanup watchers and stop the bot correctly.
 func (cfg *Config) cleanup() {
-	// Kill the child processes for the guilds/channels being watched.
-	for _, w := range cfg.watched {
-		w.Talk(w.pid + "die")
-	}
-
-	cfg.Core.Stop()
-	cfg.DB.Close()
+	cfg.stop()
 	fmt.Println("\nBot stopped, exiting.")
 	os.Exit(0)
 }
 
-// clientLaunch creates a new instance whose purpose is to listen for incoming messages.
-func clientLaunch() {
-	fmt.Print("Connecting to " + watcherHost + ":" + watcherPort + "... ")
-	conn, err := net.Dial("tcp", watcherHost+":"+watcherPort)
-	if err != nil {
-		fmt.Println(err)
-		return
+// stop disconnects the watchers, the bot and the database.
+func (cfg *Config) stop() {
+	// Stop the guilds/channels being watched, disconnecting their clients.
+	for _, w := range cfg.watchList() {
+		w.Stop()
 	}
 
-	fmt.Println("Connected!")
-	pID := strconv.Itoa(os.Getpid())
-
-	// Send our PID (childs) to the spawning (parent) process.
-	conn.Write([]byte(pID + "\n"))
-
-	fmt.Println("<-- " + "Exchanged our PID: " + pID)
-	killswitch := pID + "die"
-
-	// Print messages recieved... and break if we get the killswitch "[PID]die"
-	for {
-		message, _ := bufio.NewReader(conn).ReadString('\n')
-		fmt.Print(string(message))
-		if stripWhiteSpace(string(message)) == killswitch {
-			break
-		}
-
-	}
-
-	// Close the socket and exit.
-	conn.Close()
+	cfg.Core.Stop()
+	cfg.DB.Close()
 }
 
-// Used to verify/register default aliases.
-func (cfg *Config) defaultAliases(serverID string) error {
+// Used to verify/register default aliases. Defaults are global aliases shared by
+// every guild, copies made in each guild by older versions are removed.
+func (cfg *Config) defaultAliases() error {
 
 	type aliasSimple struct {
 		caller string
@@ -258,11 +279,34 @@ func (cfg *Config) defaultAliases(serverID string) error {
 	aliases[3] = aliasSimple{"me", "user"}
 	aliases[4] = aliasSimple{"beep", "echo Beep Boop..."}
 
+	user := UserNew(cfg.Core.User)
 	for _, a := range aliases {
-		user := UserNew(cfg.Core.User)
-		alias := AliasNew(a.caller, a.linked, serverID, user)
-		if err := alias.Update(); err != nil {
-			return err
+		// Only add missing defaults so global edits aren't lost on boot.
+		alias := AliasNew(a.caller, a.linked, AliasGlobal, user)
+		if err := alias.Get(); err != nil {
+			if err != mgo.ErrNotFound {
+				return err
+			}
+			if err := alias.Update(); err != nil {
+				return err
+			}
+		}
+
+		// Remove unmodified copies of the default from each guild.
+		for _, g := range cfg.GuildConf {
+			old := AliasNew(a.caller, "", g.ID, user)
+			if err := old.Get(); err != nil {
+				if err == mgo.ErrNotFound {
+					continue
+				}
+				return err
+			}
+
+			if old.Linked == a.linked && old.AddedBy.ID == user.ID && !old.Disabled {
+				if err := old.Remove(); err != nil {
+					return err
+				}
+			}
 		}
 	}
 	return nil
@@ -56,13 +56,22 @@ func (cfg *Config) messageCreateHandler(s *discordgo.Session, m *discordgo.Messa
 			s.ChannelMessageSendEmbed(c.ID, embedCreator(helptxt, ColorGray))
 		}
 
+		// Votes for anonymous polls are sent privately.
+		if cmd, io := strToCommands(m.Content, ConfigFile.Prefix); cmd && len(io) > 0 && strings.ToLower(io[0]) == "vote" {
+			if msg, err := cfg.voteDM(m.Author, io); err != nil {
+				s.ChannelMessageSendEmbed(c.ID, embedCreator(err.Error(), ColorMaroon))
+			} else {
+				s.ChannelMessageSendEmbed(c.ID, embedCreator(msg, ColorGreen))
+			}
+		}
+
 		// Log message into Database
 		if _, err := messageLogger("private", c.ID, "", m.Message); err != nil {
 			fmt.Println(err)
 		}
 
 		// Check if it's being watched by WatchLogger
-		cfg.watchLogHandler(nil, m, "private")
+		cfg.watchLogHandler(watchEventMessage("private", "private", "", m.Message))
 
 		return
 	}
@@ -100,6 +109,8 @@ func (cfg *Config) messageCreateHandler(s *discordgo.Session, m *discordgo.Messa
 	// Log message into Database
 	if _, err := messageLogger(g.Name, g.ID, c.Name, m.Message); err != nil {
 		fmt.Println(err)
+	} else if gConf.Attachments && len(m.Attachments) > 0 {
+		cfg.blobQueueAdd(gConf, m.ID, attachmentsNew(m.Attachments))
 	}
 
 	dat := msgToIOdata(m, gConf.Prefix)
@@ -111,7 +122,7 @@ func (cfg *Config) messageCreateHandler(s *discordgo.Session, m *discordgo.Messa
 	cfg.allianceHandler(m.Message)
 
 	// Handle potential WatchLogs
-	cfg.watchLogHandler(dat.guild, m, c.Name)
+	cfg.watchLogHandler(watchEventMessage(g.ID, g.Name, c.Name, m.Message))
 
 	// Return due to not being a command and/or just an Embed.
 	if dat.command == false || len(dat.io) == 0 {
@@ -150,13 +161,19 @@ func (cfg *Config) messageCreateHandler(s *discordgo.Session, m *discordgo.Messa
 }
 
 // messageUpdateHandler takes care of message edits and reflects the modification into the database.
-// TAG: TODO make this edit the bots Alliance messages as well.
 func (cfg *Config) messageUpdateHandler(s *discordgo.Session, mu *discordgo.MessageUpdate) {
 	var channel *godbot.Channel
 	var guild *godbot.Guild
 	var database string
 	var err error
 
+	// Edits made by users carry an edited timestamp, embeds being added don't.
+	if mu.EditedTimestamp != "" {
+		if err = cfg.allianceEdit(mu.Message); err != nil {
+			fmt.Println("Editing alliance relays: " + err.Error())
+		}
+	}
+
 	// MessageUpdate event is being triggered by embeds and attachments.
 	if len(mu.Embeds) > 0 {
 		return
@@ -244,9 +261,31 @@ func (cfg *Config) messageUpdateHandler(s *discordgo.Session, mu *discordgo.Mess
 		return
 	}
 
+	// Handle potential WatchLogs
+	var guildName = database
+	if guild != nil {
+		guildName = guild.Name
+	}
+	ev := watchEventNew(watchEdit, database, guildName, &msg)
+	ev.Time = msg.EditedTimestamp
+	ev.ChannelID, ev.ChannelName = channel.ID, channel.Name
+	if ev.UserID == "" && mu.Author != nil {
+		ev.UserID, ev.Username, ev.Discriminator = mu.Author.ID, mu.Author.Username, mu.Author.Discriminator
+	}
+	cfg.watchLogHandler(ev)
+
 	return
 }
 
+// messageDeleteHandler removes the relayed copies of deleted messages, and
+// records the deletion in the archive.
+func (cfg *Config) messageDeleteHandler(s *discordgo.Session, md *discordgo.MessageDelete) {
+	if err := cfg.allianceDelete(md.ID); err != nil {
+		fmt.Println("Deleting alliance relays: " + err.Error())
+	}
+	cfg.messageDeleted(md.ChannelID, []string{md.ID}, false)
+}
+
 // messageLogger logs the supplied message into a local database.
 func messageLogger(database, databaseID, channel string, msg *discordgo.Message) (bool, error) {
 
@@ -370,6 +409,7 @@ func MessageNew(channelName string, m *discordgo.Message) *Message {
 		Timestamp:       ts,
 		EditedTimestamp: ets,
 		Author:          u.Basic(),
+		Attachments:     attachmentsNew(m.Attachments),
 	}
 }
 
@@ -391,6 +431,15 @@ func (m *Message) Get(database string) error {
 	return nil
 }
 
+// messageIndex keeps a message from being archived twice, when it is added
+// by several imports at once.
+var messageIndex = mgo.Index{
+	Key:        []string{"id"},
+	Name:       "id",
+	Unique:     true,
+	Background: true,
+}
+
 // Update Checks and if not exists... Adds to the database.
 func (m *Message) Update(database string) (bool, error) {
 	var q = make(map[string]interface{})
@@ -400,7 +449,9 @@ func (m *Message) Update(database string) (bool, error) {
 	if err := db.dbExists(); err != nil {
 		if err == ErrNoDocument {
 			// Insert the message into the database here.
-			if err := db.dbInsert(); err != nil {
+			if err := db.dbInsert(); mgo.IsDup(err) {
+				return false, nil // Added since it was checked.
+			} else if err != nil {
 				return false, err
 			}
 			return true, nil
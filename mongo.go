@@ -34,6 +34,12 @@ const (
 	CollectionChannels  = "channels"
 	CollectionTickets   = "tickets"
 	CollectionConfig    = "config"
+	CollectionCommands  = "commands"
+	CollectionPolls     = "polls"
+	CollectionRelays    = "relays"
+	CollectionAllyKeys  = "alliancekeys"
+	CollectionBlobs     = "blobs"
+	CollectionCounters  = "counters"
 )
 
 // DBdata passes information as to what to store into a database.
@@ -47,7 +53,7 @@ type DBdata struct {
 	Change     bson.M
 }
 
-//DBHandler Stores a MongoDB connection.
+// DBHandler Stores a MongoDB connection.
 type DBHandler struct {
 	*mgo.Session
 }
@@ -211,6 +217,159 @@ func (dat *DBdata) dbGetWithLimit(i interface{}, sort []string, amount int) erro
 	return nil
 }
 
+// dbGetPage gets a page of the documents matching the query, and how many match in all.
+func (dat *DBdata) dbGetPage(i interface{}, sort []string, skip, amount int) (int, error) {
+	var unk []interface{}
+	var err error
+	var n int
+
+	mdb := dat.Handler
+
+	c := mdb.DB(dat.Database).C(dat.Collection)
+	q := c.Find(dat.Query)
+	if n, err = q.Count(); err != nil {
+		return -1, err
+	}
+
+	err = q.Sort(sort...).Skip(skip).Limit(amount).All(&unk)
+	if err != nil {
+		return -1, err
+	}
+
+	for _, p := range unk {
+		h, err := handlerForInterface(i, p)
+		if err != nil {
+			return -1, err
+		}
+		dat.Documents = append(dat.Documents, h)
+	}
+
+	return n, nil
+}
+
+// dbIndex creates an index on the collection if it doesn't have it yet.
+func (dat *DBdata) dbIndex(index mgo.Index) error {
+	mdb := dat.Handler
+
+	c := mdb.DB(dat.Database).C(dat.Collection)
+	return c.EnsureIndex(index)
+}
+
+// dbUpsert applies the change to the document matching the query, creating
+// the document if there isn't one.
+func (dat *DBdata) dbUpsert() error {
+	if dat.Query == nil {
+		return ErrNilQuery
+	} else if dat.Change == nil {
+		return ErrNilChange
+	}
+
+	mdb := dat.Handler
+
+	c := mdb.DB(dat.Database).C(dat.Collection)
+	_, err := c.Upsert(dat.Query, dat.Change)
+	return err
+}
+
+// dbIncrement adds one to a number field of the document matching the query,
+// creating the document if there isn't one, and returns the new number.
+func (dat *DBdata) dbIncrement(field string) (int, error) {
+	mdb := dat.Handler
+
+	change := mgo.Change{
+		Update:    bson.M{"$inc": bson.M{field: 1}},
+		Upsert:    true,
+		ReturnNew: true,
+	}
+
+	var res bson.M
+	c := mdb.DB(dat.Database).C(dat.Collection)
+	if _, err := c.Find(dat.Query).Apply(change, &res); err != nil {
+		return -1, err
+	}
+
+	switch n := res[field].(type) {
+	case int:
+		return n, nil
+	case int64:
+		return int(n), nil
+	}
+	return -1, ErrUnknownType
+}
+
+// dbSum adds up a number field of the documents matching the query.
+func (dat *DBdata) dbSum(field string) (int64, error) {
+	mdb := dat.Handler
+
+	var match = dat.Query
+	if match == nil {
+		match = bson.M{}
+	}
+
+	var res struct {
+		Total int64 `bson:"total"`
+	}
+	c := mdb.DB(dat.Database).C(dat.Collection)
+	err := c.Pipe([]bson.M{
+		{"$match": match},
+		{"$group": bson.M{"_id": nil, "total": bson.M{"$sum": "$" + field}}},
+	}).One(&res)
+	if err == mgo.ErrNotFound {
+		return 0, nil
+	}
+	return res.Total, err
+}
+
+// dbDedupe removes documents with the same value of a field, keeping the
+// first one added. Returns how many were removed.
+func (dat *DBdata) dbDedupe(field string) (int, error) {
+	mdb := dat.Handler
+
+	c := mdb.DB(dat.Database).C(dat.Collection)
+	iter := c.Pipe([]bson.M{
+		{"$sort": bson.M{"_id": 1}},
+		{"$group": bson.M{"_id": "$" + field, "ids": bson.M{"$push": "$_id"}, "count": bson.M{"$sum": 1}}},
+		{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+	}).AllowDiskUse().Iter()
+
+	var removed int
+	var dup struct {
+		IDs []bson.ObjectId `bson:"ids"`
+	}
+	for iter.Next(&dup) {
+		info, err := c.RemoveAll(bson.M{"_id": bson.M{"$in": dup.IDs[1:]}})
+		if err != nil {
+			iter.Close()
+			return removed, err
+		}
+		removed += info.Removed
+	}
+	return removed, iter.Close()
+}
+
+// dbIter calls fn with each document matching the query in order, reading
+// them as they are needed. Stops at the first error fn returns.
+func (dat *DBdata) dbIter(i interface{}, sort []string, fn func(interface{}) error) error {
+	mdb := dat.Handler
+
+	c := mdb.DB(dat.Database).C(dat.Collection)
+	iter := c.Find(dat.Query).Sort(sort...).Iter()
+
+	var unk interface{}
+	for iter.Next(&unk) {
+		h, err := handlerForInterface(i, unk)
+		if err == nil {
+			err = fn(h)
+		}
+		if err != nil {
+			iter.Close()
+			return err
+		}
+		unk = nil
+	}
+	return iter.Close()
+}
+
 func (dat *DBdata) dbGetAll(i interface{}) error {
 	var unk []interface{}
 	var err error
@@ -297,18 +456,6 @@ func (dat *DBdata) dbExists() error {
 
 }
 
-// CoreDatabase will control adding and removing user defined commands.
-func (dat *IOdata) CoreDatabase() (err error) {
-
-	switch dat.io[0] {
-	case "add":
-	case "edit":
-	case "del":
-	}
-
-	return nil
-}
-
 func handlerForInterface(handler interface{}, i interface{}) (interface{}, error) {
 	byt, _ := bson.Marshal(i)
 	switch handler.(type) {
@@ -348,6 +495,26 @@ func handlerForInterface(handler interface{}, i interface{}) (interface{}, error
 		var t Ticket
 		bson.Unmarshal(byt, &t)
 		return t, nil
+	case Command:
+		var c Command
+		bson.Unmarshal(byt, &c)
+		return c, nil
+	case Poll:
+		var p Poll
+		bson.Unmarshal(byt, &p)
+		return p, nil
+	case Relay:
+		var r Relay
+		bson.Unmarshal(byt, &r)
+		return r, nil
+	case AllianceKey:
+		var k AllianceKey
+		bson.Unmarshal(byt, &k)
+		return k, nil
+	case Blob:
+		var b Blob
+		bson.Unmarshal(byt, &b)
+		return b, nil
 	default:
 		return nil, ErrBadInterface
 	}
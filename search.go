@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/pborman/getopt/v2"
+)
+
+// searchPerPage is how many messages are shown on a page of search results,
+// kept low so that a page fits within an embed.
+const searchPerPage = 5
+
+// searchFilesMax is how many attachments of a message are listed in results.
+const searchFilesMax = 3
+
+// searchDescMax is the most characters Discord shows in an embed's description,
+// results and files that don't fit are left out.
+const searchDescMax = 2048
+
+// searchNoteMax is room kept for the note saying results were left out.
+const searchNoteMax = 64
+
+// searchIndex is the text index searches of the archived messages use.
+var searchIndex = mgo.Index{
+	Key:        []string{"$text:content", "$text:editedcontent"},
+	Name:       "search",
+	Background: true,
+}
+
+// searchLayouts are the formats accepted for --before and --after.
+var searchLayouts = []string{"2006-01-02", "2006-01-02 15:04", time.RFC3339}
+
+// CoreSearch searches the archived messages of the guild.
+func (dat *IOdata) CoreSearch() error {
+	// Return if the user does not have the role
+	if ok := dat.user.HasRoleType(dat.guildConfig, rolePermissionMod); !ok {
+		return ErrBadPermissions
+	}
+
+	var help bool
+	var user, channel, before, after, file string
+	var page = 1
+
+	fl := getopt.New()
+	fl.FlagLong(&user, "user", 'u', "Only messages by this user, @mention or ID")
+	fl.FlagLong(&channel, "channel", 'c', "Only messages in this channel, #mention or name")
+	fl.FlagLong(&before, "before", 'b', "Only messages before a date, YYYY-MM-DD")
+	fl.FlagLong(&after, "after", 'a', "Only messages after a date, YYYY-MM-DD")
+	fl.FlagLong(&file, "file", 'f', "Only messages with an attachment named like this, '*' for any")
+	fl.FlagLong(&page, "page", 'p', "Page of results to show")
+	fl.FlagLong(&help, "help", 'h', "This message")
+
+	// Words to search for can be before, between, or after the flags. Each
+	// parse stops at a word, which then stands in for the command's name.
+	var words []string
+	for args := dat.io; ; args = fl.Args() {
+		if err := fl.Getopt(args, nil); err != nil {
+			return err
+		} else if fl.NArgs() == 0 {
+			break
+		}
+		words = append(words, fl.Arg(0))
+	}
+
+	text := strings.Join(words, " ")
+	if help || (text == "" && file == "") {
+		dat.output = Help(fl, "", "\nExample: search \"server down\" --user @name --after 2017-06-01")
+		return nil
+	}
+
+	var q = bson.M{}
+	if text != "" {
+		q["$text"] = bson.M{"$search": text}
+	}
+	if file == "*" {
+		q["attachments.0"] = bson.M{"$exists": true}
+	} else if file != "" {
+		q["attachments.filename"] = bson.RegEx{Pattern: regexp.QuoteMeta(file), Options: "i"}
+	}
+	if user != "" {
+		q["author.id"] = userIDParse(user)
+	}
+	if channel != "" {
+		q["channelid"] = searchChannel(dat.guild.ID, channel)
+	}
+
+	var span = bson.M{}
+	for flag, t := range map[string]string{"$lt": before, "$gt": after} {
+		if t == "" {
+			continue
+		}
+		d, err := searchTime(t)
+		if err != nil {
+			return err
+		}
+		span[flag] = d
+	}
+	if len(span) > 0 {
+		q["timestamp"] = span
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	dbdat := DBdataCreate(dat.guild.ID, CollectionMessages, Message{}, q, nil)
+	if err := dbdat.dbIndex(searchIndex); err != nil {
+		return err
+	}
+	total, err := dbdat.dbGetPage(Message{}, []string{"-timestamp"}, (page-1)*searchPerPage, searchPerPage)
+	if err != nil {
+		return err
+	} else if total == 0 {
+		return errors.New("no messages found")
+	}
+
+	var pages = (total + searchPerPage - 1) / searchPerPage
+	if page > pages {
+		return fmt.Errorf("there are only %d pages", pages)
+	}
+
+	var msg string
+	for n, d := range dbdat.Documents {
+		room := searchDescMax - searchNoteMax - utf8.RuneCountInString(msg)
+		res := searchResult(dat.guild.ID, d.(Message), room)
+		if utf8.RuneCountInString(res) > room {
+			msg += fmt.Sprintf("_%d more results on this page didn't fit, narrow the search._", len(dbdat.Documents)-n)
+			break
+		}
+		msg += res
+	}
+
+	dat.msgEmbed = embedCreator(msg, ColorBlue)
+	dat.msgEmbed.Title = fmt.Sprintf("Search: %s", text)
+	if text == "" {
+		dat.msgEmbed.Title = fmt.Sprintf("Search: files named %s", file)
+	}
+	dat.msgEmbed.Footer = &discordgo.MessageEmbedFooter{
+		Text: fmt.Sprintf("Page %d of %d, %d messages. Use --page for more.", page, pages, total),
+	}
+	return nil
+}
+
+// searchResult is a line of the search results with a jump link to the message,
+// and its attachments as long as they fit in the room left.
+func searchResult(guildID string, m Message, room int) string {
+	content := strings.Replace(m.Content, "\n", " ", -1)
+	if r := []rune(content); len(r) > 200 {
+		content = string(r[:197]) + "..."
+	}
+
+	head := fmt.Sprintf("**%s** in #%s, %s [[jump]](%s)\n",
+		m.Author.Name, m.ChannelName, m.Timestamp.Format("2006-01-02 15:04"),
+		messageLink(guildID, m.ChannelID, m.ID))
+
+	// Room is kept for the line counting the files left out.
+	used := utf8.RuneCountInString(head+content) + len("\n+99 more files\n\n")
+	for n, a := range m.Attachments {
+		line := "\n" + searchFile(guildID, a)
+		if n == searchFilesMax || used+utf8.RuneCountInString(line) > room {
+			content += fmt.Sprintf("\n+%d more files", len(m.Attachments)-n)
+			break
+		}
+		content += line
+		used += utf8.RuneCountInString(line)
+	}
+
+	return head + strings.TrimSpace(content) + "\n\n"
+}
+
+// searchFile is an attachment of a search result. Discord's links expire, so
+// those stored on the bot link to the dashboard when it is reachable.
+func searchFile(guildID string, a Attachment) string {
+	name := strings.NewReplacer("[", "", "]", "").Replace(a.Filename)
+	line := fmt.Sprintf(":paperclip: [%s](%s) %s", name, a.URL, blobSize(int64(a.Size)))
+	if url := (&blobStore{GuildID: guildID}).URL(a.Hash); url != "" {
+		line += fmt.Sprintf(", [archived](%s)", url)
+	} else if a.Hash != "" {
+		line += ", archived"
+	}
+	return line
+}
+
+// messageLink is a link that jumps to a message in Discord.
+func messageLink(guildID, channelID, messageID string) string {
+	return fmt.Sprintf("https://discordapp.com/channels/%s/%s/%s", guildID, channelID, messageID)
+}
+
+// searchChannel gets the ID of a channel from its mention or name. Archived
+// messages of deleted channels can be found by ID.
+func searchChannel(guildID, channel string) string {
+	if id := strings.TrimSuffix(strings.TrimPrefix(channel, "<#"), ">"); id != channel {
+		return id
+	}
+
+	channel = strings.TrimPrefix(channel, "#")
+	var q = bson.M{"channelname": channel}
+	dbdat := DBdataCreate(guildID, CollectionMessages, Message{}, q, nil)
+	if err := dbdat.dbGet(Message{}); err != nil {
+		return channel
+	}
+	return dbdat.Document.(Message).ChannelID
+}
+
+// searchTime reads a date given to --before or --after.
+func searchTime(t string) (time.Time, error) {
+	for _, layout := range searchLayouts {
+		if d, err := time.Parse(layout, t); err == nil {
+			return d, nil
+		}
+	}
+	return time.Time{}, errors.New("bad date '" + t + "', use YYYY-MM-DD")
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"os/exec"
+	"net"
 	"sync"
 
 	mgo "gopkg.in/mgo.v2"
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/chzyer/readline"
 	"github.com/d0x1p2/godbot"
 )
 
@@ -23,11 +24,38 @@ type Config struct {
 
 	// Alliance slices
 	Alliances []Alliance
-	pending   []Alliance // Pending alliances.
+
+	// Line editor of the console, nil when not on it.
+	line *readline.Instance
 
 	// Watched Guilds/Channels
-	watched  []WatchLog
-	children []*exec.Cmd
+	watched    []*WatchLog
+	watchedID  int
+	watchedMu  sync.Mutex
+	watchToken string // Generated if the configuration file has no WatchToken.
+
+	// Guild configuration bundles waiting to be confirmed, by guild ID.
+	imports   map[string]*GuildBundle
+	importsMu sync.Mutex
+
+	// Times users relayed to alliances, for rate limits. Queued relays are in the future.
+	relayed   map[string][]time.Time
+	relayedMu sync.Mutex
+
+	// Connections to IRC channels bridged into alliances, by member channel ID.
+	irc   map[string]*ircClient
+	ircMu sync.Mutex
+
+	// Deletions counted of the audit log entries of deleted messages, by entry ID.
+	audits   map[string]int
+	auditsMu sync.Mutex
+
+	// Held while a file is added to a blob store, so quotas aren't overrun.
+	blobsMu sync.Mutex
+
+	// Messages waiting for their attachments to be downloaded.
+	blobQueue     chan blobJob
+	blobQueueOnce sync.Once
 }
 
 // ConfigJSON is what is loaded from a file.
@@ -40,6 +68,17 @@ type ConfigJSON struct {
 	PastebinAcct  string
 	PastebinToken string
 	GuildURL      string
+	WatchToken    string // Secret WatchLog clients authenticate with, optional.
+
+	Dashboard         string // Address the web dashboard listens on, disabled if empty.
+	DashboardUser     string
+	DashboardPassword string
+	APIToken          string // Token for the JSON API on the dashboard's address, optional.
+	DashboardURL      string // Address people reach the dashboard at, for links to stored files. Optional.
+
+	BlobDir              string // Directory guilds' attachments are stored in. Defaults to: "blobs"
+	AttachmentMaxLimit   int64  // Largest file, in MB, a guild can allow. Defaults to: 8
+	AttachmentQuotaLimit int64  // Most space, in MB, a guild's files can use. Defaults to: 1024
 }
 
 // Bot is a wrapper for the godbot.Core
@@ -72,6 +111,11 @@ type GuildConfig struct {
 	Init   bool
 	Roles  []Role
 	Prefix string // Command prefix. Defaults to: ","
+
+	// Attachments are downloaded into the blob store when enabled.
+	Attachments     bool
+	AttachmentMax   int64 // Largest file stored, in bytes. Defaults to: 8MB
+	AttachmentQuota int64 // Space the guild's files can use, in bytes. Defaults to: 1GB
 }
 
 // GuildRole holds all Roles for a specific guild.
@@ -89,6 +133,17 @@ type Role struct {
 	Base  int // Stock permissions
 }
 
+// Attachment is a file sent with a message.
+type Attachment struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	URL      string `json:"url"`
+	Size     int    `json:"size"`
+	Width    int    `json:"width,omitempty"` // Set for images.
+	Height   int    `json:"height,omitempty"`
+	Hash     string `json:"sha256,omitempty"` // Of the file in the guild's blob store, empty if not stored.
+}
+
 // Message holds basic information related to a specific message.
 type Message struct {
 	ID              string
@@ -99,6 +154,9 @@ type Message struct {
 	Timestamp       time.Time
 	EditedTimestamp time.Time
 	Author          UserBasic
+	Deleted         time.Time // When the message was deleted, zero if it wasn't.
+	DeletedBy       UserBasic // Who deleted it, if the audit log tells.
+	Attachments     []Attachment
 	// AuthorMsg       int   // Removed for now (was message count)
 }
 
@@ -166,7 +224,16 @@ type UserBasic struct {
 
 // Command structure for User Defined commands.
 type Command struct {
-	ID bson.ObjectId `bson:"_id,omitempty"`
+	ID         bson.ObjectId `bson:"_id,omitempty"`
+	Name       string        // Text that calls the command.
+	Response   string        // Template that is sent when called.
+	Color      int           // Embed color, sent as plain text if 0.
+	Permission string        // Role needed: "", "mod", or "admin".
+	Channels   []string      // Channel IDs it can be used in, all if empty.
+	Count      int           // Times the command has been used.
+	ServerID   string
+	AddedBy    UserBasic
+	DateAdded  time.Time
 }
 
 // Alias contains information regarding an alias link.
@@ -175,7 +242,12 @@ type Alias struct {
 	Caller   string        // String that calls the alias.
 	Linked   string        // What the real command is.
 	ServerID string        // ID of the server.
+	Disabled bool          // Hides the global alias of the same Caller.
 	AddedBy  UserBasic     // Person who added alias.
+
+	// Placeholders is set on aliases saved since they were supported, older
+	// aliases keep any '$' as text and have their arguments appended.
+	Placeholders bool
 }
 
 // WatchLog holds basic information about a channel/server to be watched.
@@ -187,7 +259,9 @@ type WatchLog struct {
 	channelName string
 	channelAll  bool
 
-	channel chan string
-	pid     string
-	port    int
+	id      int
+	channel chan WatchEvent // Events waiting to be written.
+	quit    chan struct{}   // Closed to stop the watcher.
+	stop    sync.Once
+	ln      net.Listener // Listener a client attaches to, nil if printed to this terminal.
 }
@@ -12,12 +12,13 @@ import (
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/d0x1p2/godbot"
-	"gopkg.in/mgo.v2"
 )
 
 // Error constants.
 var (
-	ErrMsgEnding = errors.New("reached ending message")
+	ErrMsgEnding      = errors.New("reached ending message")
+	ErrGuildUnknown   = errors.New("unknown guild")
+	ErrChannelUnknown = errors.New("unknown channel for that guild")
 )
 
 // Color constants for embeded messages.
@@ -145,16 +146,11 @@ func (cfg *Config) ioHandler(dat *IOdata) error {
 		}
 	}
 
-	// Check if an alias here
-	alias := AliasNew(dat.io[0], "", dat.guild.ID, dat.user)
-	link, err := alias.Check()
-	if err != nil {
-		if err != mgo.ErrNotFound {
-			return err
-		}
-		err = nil
-	} else {
-		dat.io = aliasConv(dat, link)
+	// Check if an alias here, following any aliases it links to.
+	if err = aliasResolve(dat); err != nil {
+		return err
+	} else if len(dat.io) == 0 {
+		return nil
 	}
 
 	command := dat.io[0]
@@ -193,12 +189,107 @@ func (cfg *Config) ioHandler(dat *IOdata) error {
 		return dat.messageClear(cfg.Core.Session, "slow")
 	case "vote":
 		return dat.CoreVote()
+	case "search":
+		return dat.CoreSearch()
+	case "archive":
+		return dat.CoreArchive()
+	case "deleted":
+		return dat.CoreDeleted()
 	case "admin":
 		return cfg.CoreAdmin(dat)
 	case "contributions", "contributors", "donators", "contribute", "thanks", "ty":
 		dat.output = thankYou()
 	case "echo":
 		dat.output = echoMsg(dat.io[1:])
+	default:
+		return dat.CommandRun()
+	}
+	return nil
+}
+
+// ioDataCreate prepares a command as if a user had sent it in a guild's channel.
+// The bot is the user if none is given, and the main channel if no channel is.
+func (cfg *Config) ioDataCreate(guildID, channelID, userID, content string) (*IOdata, error) {
+	guild := cfg.Core.GetGuild(guildID)
+	guildConfig := cfg.GuildConfigByID(guildID)
+	if guild == nil || guildConfig == nil {
+		return nil, ErrGuildUnknown
+	}
+
+	if channelID == "" {
+		if c := cfg.Core.GetMainChannel(guildID); c != nil {
+			channelID = c.ID
+		}
+	}
+	if cfg.guildChannel(guildID, channelID) == nil {
+		return nil, ErrChannelUnknown
+	}
+
+	// The bot's roles are loaded if it is in the database, it can run as itself either way.
+	user := UserNew(cfg.Core.User)
+	if userID == "" {
+		user.Get(user.ID)
+	} else if err := user.Get(userIDParse(userID)); err != nil {
+		return nil, err
+	}
+
+	msg := &discordgo.MessageCreate{Message: &discordgo.Message{
+		ChannelID: channelID,
+		Content:   guildConfig.Prefix + content,
+		Author:    &discordgo.User{ID: user.ID, Username: user.Username, Discriminator: user.Discriminator, Bot: user.Bot},
+	}}
+
+	dat := msgToIOdata(msg, guildConfig.Prefix)
+	dat.user = user
+	dat.guild = guild
+	dat.guildConfig = guildConfig
+	dat.session = cfg.Core.Session
+	return dat, nil
+}
+
+// ioExec runs a command prepared by ioDataCreate, posting the result to the
+// channel if asked.
+func (cfg *Config) ioExec(dat *IOdata, post bool) error {
+	// Users in the ban role can't use the bot from anywhere.
+	if ok := dat.user.HasRoleType(dat.guildConfig, rolePermissionBan); ok {
+		return ErrBadPermissions
+	}
+
+	if err := cfg.ioHandler(dat); err != nil {
+		return err
+	} else if !post {
+		return nil
+	}
+
+	var err error
+	if dat.output != "" {
+		_, err = cfg.Core.Session.ChannelMessageSend(dat.msg.ChannelID, dat.output)
+	} else if dat.msgEmbed != nil {
+		_, err = cfg.Core.Session.ChannelMessageSendEmbed(dat.msg.ChannelID, dat.msgEmbed)
+	}
+	return err
+}
+
+// channelSend posts a message to a guild's channel, as an embed if a color is given.
+func (cfg *Config) channelSend(guildID, channelID, content string, color int) (*discordgo.Message, error) {
+	if cfg.guildChannel(guildID, channelID) == nil {
+		return nil, ErrChannelUnknown
+	} else if strings.TrimSpace(content) == "" {
+		return nil, errors.New("nothing to send")
+	}
+
+	if color != 0 {
+		return cfg.Core.Session.ChannelMessageSendEmbed(channelID, embedCreator(content, color))
+	}
+	return cfg.Core.Session.ChannelMessageSend(channelID, content)
+}
+
+// guildChannel finds a channel of a guild.
+func (cfg *Config) guildChannel(guildID, channelID string) *discordgo.Channel {
+	for _, c := range cfg.Core.Links[guildID] {
+		if c.ID == channelID {
+			return c
+		}
 	}
 	return nil
 }
@@ -376,30 +376,11 @@ func (u *User) BotAbuse(dat *IOdata, cID string, fl userFlags) error {
 	}
 
 	if uID != "" {
-		// Find user.
-		criminal := UserNew(nil)
-		if err = criminal.Get(uID); err != nil {
+		if err = botAbuseSet(dat.session, dat.guildConfig, uID, true); err != nil {
 			return err
 		}
 
-		// Apply the role to the user on Discord.
-		roleID := dat.guildConfig.RoleIDGet(0)
-		if roleID == "" {
-			return errors.New("Unable to find role to apply to newly banned used")
-		}
-		if err := dat.session.GuildMemberRoleAdd(dat.guildConfig.ID, criminal.ID, roleID); err != nil {
-			return err
-		}
-
-		// Apply the banned role to the user in memory.
-		criminal.RoleAdd(dat.guild.ID, roleID)
-
-		// Apply the role to the user in the database.
-		if err := criminal.Update(); err != nil {
-			return err
-		}
-
-		dat.output = fmt.Sprintf("Bot access has been __**revoked**__ for <@%s>.", criminal.ID)
+		dat.output = fmt.Sprintf("Bot access has been __**revoked**__ for <@%s>.", uID)
 		return nil
 	}
 
@@ -411,6 +392,41 @@ func abuseList(dat *IOdata, database, id string) error {
 	return nil
 }
 
+// botAbuseSet revokes or restores a user's access to the bot in a guild.
+func botAbuseSet(s *discordgo.Session, guildConfig *GuildConfig, userID string, revoke bool) error {
+	return userRoleSet(s, guildConfig, userID, rolePermissionBan, revoke)
+}
+
+// userRoleSet grants or takes one of the bot's roles, by its base, from a user.
+func userRoleSet(s *discordgo.Session, guildConfig *GuildConfig, userID string, base int, grant bool) error {
+	// Find user.
+	user := UserNew(nil)
+	if err := user.Get(userID); err != nil {
+		return err
+	}
+
+	roleID := guildConfig.RoleIDGet(base)
+	if roleID == "" {
+		return errors.New("Unable to find the role in the guild")
+	}
+
+	// Apply the role to the user on Discord, then in memory.
+	if grant {
+		if err := s.GuildMemberRoleAdd(guildConfig.ID, user.ID, roleID); err != nil {
+			return err
+		}
+		user.RoleAdd(guildConfig.ID, roleID)
+	} else {
+		if err := s.GuildMemberRoleRemove(guildConfig.ID, user.ID, roleID); err != nil {
+			return err
+		}
+		user.RoleRemove(guildConfig.ID, roleID)
+	}
+
+	// Apply the role to the user in the database.
+	return user.Update()
+}
+
 /*
 	GAMBLE RELATED
 	ACTIONS
@@ -584,10 +600,13 @@ func (u *User) RoleAdd(guildID, roleID string) {
 // RoleRemove from a user.
 func (u *User) RoleRemove(guildID, roleID string) {
 	for m, g := range u.GuildRoles {
+		if g.ID != guildID {
+			continue
+		}
 		for n, r := range g.Roles {
 			if r == roleID {
 				if len(g.Roles) == 1 {
-					g.Roles = nil
+					u.GuildRoles[m].Roles = nil
 					return
 				}
 				length := len(u.GuildRoles[m].Roles)
@@ -604,6 +623,17 @@ func (u *User) RoleRemove(guildID, roleID string) {
 	Miscellanous Functions
 */
 
+// userIDParse returns the ID of a user from either a mention or an ID.
+func userIDParse(str string) string {
+	str = strings.TrimSpace(str)
+	if strings.Trim(str, "<@!>") == "" {
+		return ""
+	} else if strings.ContainsRune(str, '@') {
+		return userIDClean(str)
+	}
+	return str
+}
+
 // Attempts to return an ID of a user despite <@ID> or Name#Discrim format.
 func userIDClean(str string) string {
 	if strings.ContainsRune(str, '@') {
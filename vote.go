@@ -3,18 +3,92 @@ package main
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/pborman/getopt/v2"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Errors for polls.
+var (
+	ErrPollNotFound = errors.New("poll not found, check the poll number")
+	ErrPollClosed   = errors.New("that poll has already closed")
 )
 
 // Constants for producing helpful text for normal command operations.
 const (
-	voteSyntaxAdd  = ",vote   --title \"Title Here\"\n"
-	voteSyntaxDesc = ",vote   --title \"Title Here\"   -d \"Description Here\"\n"
-	voteSyntaxAll  = voteSyntaxAdd + voteSyntaxDesc
+	voteSyntaxAdd     = ",vote   --title \"Title Here\"\n"
+	voteSyntaxDesc    = ",vote   --title \"Title Here\"   -d \"Description Here\"\n"
+	voteSyntaxOptions = ",vote   --title \"Lunch?\"   -o \"Pizza,Tacos,Sushi\"   --duration 2h   --channel #general\n"
+	voteSyntaxAnon    = ",vote   --title \"Lunch?\"   -o \"Pizza,Tacos\"   --anonymous\n"
+	voteSyntaxRanked  = ",vote   --title \"Next game?\"   -o \"Chess,Go,Poker\"   --ranked   --weight role\n"
+	voteSyntaxResults = ",vote   --results 12\n,vote   --close 12\n,vote   --list\n"
+	voteSyntaxAll     = voteSyntaxAdd + voteSyntaxDesc + voteSyntaxOptions + voteSyntaxAnon + voteSyntaxRanked + voteSyntaxResults
+
+	voteOptionsMax  = 10                  // Number emojis available.
+	voteDurationMax = 30 * 24 * time.Hour // Longest duration accepted, such as a poll staying open.
+	voteBarWidth    = 20                  // Characters in a full result bar.
+
+	voteWeightRole    = "role"    // Ballots weighted by the bot's roles.
+	voteWeightCredits = "credits" // Ballots weighted by the voter's credits.
+	voteWeightAdmin   = 3         // Weight of an Administrator's ballot.
+	voteWeightMod     = 2         // Weight of a Moderator's ballot.
+
+	pollVoteTries = 3 // Times a vote is tried when another of the user's lands at once.
 )
 
+// Emojis used for voting. Yes/No polls use thumbs, others use numbers.
+var (
+	voteEmojiYes = emojiIntToStr(128077) // Thumbs up: U+1F44D
+	voteEmojiNo  = emojiIntToStr(128078) // Thumbs down: U+1F44E
+
+	voteEmojiNumbers = [voteOptionsMax]string{
+		"1⃣", "2⃣", "3⃣", "4⃣", "5⃣",
+		"6⃣", "7⃣", "8⃣", "9⃣", emojiIntToStr(128287),
+	}
+)
+
+// Poll holds the information needed to post and tally a poll.
+type Poll struct {
+	ID          bson.ObjectId `bson:"_id,omitempty"`
+	PollID      int           // Number used to refer to the poll.
+	ServerID    string
+	Title       string
+	Description string
+	Options     []string // Empty for a Yes/No poll.
+	ChannelID   string
+	MessageID   string
+	Creator     UserBasic
+	Created     time.Time
+	Closes      time.Time // Zero if the poll doesn't close on its own.
+	Closed      bool
+	Anonymous   bool   // Votes are sent by DM instead of reactions.
+	Ranked      bool   // Options are ranked by DM and counted by instant runoff.
+	Weight      string // How ballots are weighted, empty for one vote each.
+	Ballots     []Ballot
+}
+
+// Ballot is a single user's vote in a poll.
+type Ballot struct {
+	User    UserBasic
+	Choices []int // Indexes of the options picked, most preferred first.
+	Weight  int   // Votes the ballot is worth in a weighted poll.
+	Date    time.Time
+}
+
+// PollResult is the tally for a single option of a poll.
+type PollResult struct {
+	Emoji  string
+	Option string
+	Voters []string
+	Votes  int
+}
+
 // CoreVote processes all voting related additions.
 func (dat *IOdata) CoreVote() error {
 	if ok := dat.user.HasRoleType(dat.guildConfig, rolePermissionMod); !ok {
@@ -22,12 +96,23 @@ func (dat *IOdata) CoreVote() error {
 	}
 
 	fl := getopt.New()
-	var title, description, msgID string
-	var help bool
+	var title, description, msgID, channel, duration, weight string
+	var options []string
+	var help, anonymous, ranked, list bool
+	var resultsID, closeID = -1, -1
 
 	// Generics
 	fl.FlagLong(&title, "title", 't', "Title of the poll.")
 	fl.FlagLong(&description, "description", 'd', "Description")
+	fl.FlagLong(&options, "options", 'o', "Up to 10 options, comma separated. Yes/No if not set.")
+	fl.FlagLong(&channel, "channel", 'c', "Channel to post in, defaults to #vote.")
+	fl.FlagLong(&duration, "duration", 0, "Closes and posts results after: 30m, 2h, 1d")
+	fl.FlagLong(&anonymous, "anonymous", 'a', "Votes are sent to the bot by DM.")
+	fl.FlagLong(&ranked, "ranked", 0, "Voters rank the options by DM, counted by instant runoff.")
+	fl.FlagLong(&weight, "weight", 'w', "Weigh votes by: role, credits")
+	fl.FlagLong(&resultsID, "results", 'r', "Poll number to show the current results of.")
+	fl.FlagLong(&closeID, "close", 0, "Poll number to close and post the results of.")
+	fl.FlagLong(&list, "list", 'l', "List the open polls.")
 	fl.FlagLong(&msgID, "get", 'g', "Message ID to retrieve information.")
 	fl.FlagLong(&help, "help", 'h', "This message")
 
@@ -40,11 +125,77 @@ func (dat *IOdata) CoreVote() error {
 		}
 	}
 
-	if msgID != "" {
-		return dat.voteGet(msgID)
+	var channelID string
+	if channel != "" {
+		var err error
+		if channelID, err = dat.voteChannelCheck(channel); err != nil {
+			return err
+		}
+	}
+
+	if list {
+		var err error
+		dat.output, err = pollList(dat.guild.ID)
+		return err
+	} else if resultsID >= 0 {
+		poll := &Poll{ServerID: dat.guild.ID}
+		if err := poll.Get(resultsID); err != nil {
+			return err
+		}
+		dat.msgEmbed = poll.ResultsEmbed()
+		return nil
+	} else if closeID >= 0 {
+		poll := &Poll{ServerID: dat.guild.ID, PollID: closeID}
+		if err := poll.Get(closeID); err != nil {
+			return err
+		} else if poll.Closed {
+			return ErrPollClosed
+		}
+		return poll.Close(dat.session)
+	} else if msgID != "" {
+		return dat.voteGet(channelID, msgID)
 	} else if title != "" {
+		poll := &Poll{
+			ServerID:    dat.guild.ID,
+			Title:       title,
+			Description: description,
+			ChannelID:   channelID,
+			Creator:     dat.user.Basic(),
+			Created:     time.Now(),
+			Anonymous:   anonymous,
+			Ranked:      ranked,
+			Weight:      strings.ToLower(weight),
+		}
+
+		for _, o := range options {
+			if o = strings.TrimSpace(o); o != "" {
+				poll.Options = append(poll.Options, o)
+			}
+		}
+		if len(poll.Options) == 1 {
+			return errors.New("a poll needs at least 2 options")
+		} else if len(poll.Options) > voteOptionsMax {
+			return fmt.Errorf("a poll can only have %d options", voteOptionsMax)
+		} else if poll.Ranked && len(poll.Options) == 0 {
+			return errors.New("a ranked poll needs options to rank")
+		}
+
+		switch poll.Weight {
+		case "", voteWeightRole, voteWeightCredits:
+		default:
+			return errors.New("votes can only be weighted by: role, credits")
+		}
+
+		if duration != "" {
+			d, err := durationParse(duration)
+			if err != nil {
+				return err
+			}
+			poll.Closes = time.Now().Add(d)
+		}
+
 		// Create #vote here and create the poll.
-		return dat.voteCreate(title, description)
+		return dat.voteCreate(poll)
 	}
 
 	// Print issue + help
@@ -54,83 +205,102 @@ func (dat *IOdata) CoreVote() error {
 	return nil
 }
 
-// voteGet information for a particular poll.
-func (dat *IOdata) voteGet(msgID string) error {
+// voteChannelCheck validates a channel mention belongs to the current guild.
+func (dat *IOdata) voteChannelCheck(channel string) (string, error) {
+	ch, err := dat.session.Channel(channelIDClean(channel))
+	if err != nil || ch.GuildID != dat.guild.ID {
+		return "", errors.New("that channel isn't part of this server")
+	}
+	return ch.ID, nil
+}
+
+// durationParse converts a duration such as "45m", "2h" or "1d".
+func durationParse(str string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+
+	if strings.HasSuffix(str, "d") {
+		var days int
+		if days, err = strconv.Atoi(strings.TrimSuffix(str, "d")); err == nil {
+			d = time.Duration(days) * 24 * time.Hour
+		}
+	} else {
+		d, err = time.ParseDuration(str)
+	}
+
+	if err != nil || d < time.Minute {
+		return 0, errors.New("bad duration, use a time such as: 30m, 2h, or 1d")
+	} else if d > voteDurationMax {
+		return 0, errors.New("durations can't be longer than 30 days")
+	}
+	return d, nil
+}
+
+// voteChannel gets the #vote channel, creating it if it doesn't exist.
+func (dat *IOdata) voteChannel(create bool) (*discordgo.Channel, error) {
 	s := dat.session
 	// Get our channels from the server.
 	channels, err := s.GuildChannels(dat.guild.ID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Check if the channel exists already.
-	var ch *discordgo.Channel
 	for _, c := range channels {
 		if c.Name == "vote" {
-			ch = c
-			break
+			return c, nil
 		}
 	}
 
-	if ch == nil {
-		return errors.New("channel doesn't exist, message doesn't exist :frowning: ")
+	if !create {
+		return nil, errors.New("channel doesn't exist, message doesn't exist :frowning: ")
 	}
 
-	var thumbsUp, thumbsDown, tU, tD []string
-	users, err := s.MessageReactions(ch.ID, msgID, emojiIntToStr(128077), 100)
-	if err != nil {
-		return errors.New("couldn't find our message :frowning: ")
-	}
-	for _, u := range users {
-		thumbsUp = append(thumbsUp, u.String())
-	}
-
-	users, err = s.MessageReactions(ch.ID, msgID, emojiIntToStr(128078), 100)
+	// Channel doesn't exists. Create it.
+	ch, err := s.GuildChannelCreate(dat.guild.ID, "vote", "text")
 	if err != nil {
-		return errors.New("couldn't find our message :frowning: ")
+		return nil, errors.New("Error creating poll, try again")
 	}
-	for _, u := range users {
-		thumbsDown = append(thumbsDown, u.String())
+	// Set the permissions to disable adding messages and additional emojis
+	if err := s.ChannelPermissionSet(ch.ID, dat.guild.ID, "role", 0, 0x00000840); err != nil {
+		return nil, errors.New("Error creating poll, try again")
 	}
+	return ch, nil
+}
 
-	arrayCheck := func(s string, a []string) bool {
-		for _, i := range a {
-			if s == i {
-				return true
-			}
+// voteGet information for a particular poll.
+func (dat *IOdata) voteGet(channelID, msgID string) error {
+	s := dat.session
+	if channelID == "" {
+		ch, err := dat.voteChannel(false)
+		if err != nil {
+			return err
 		}
-		return false
+		channelID = ch.ID
 	}
 
-	// Cycle our Thumbs Up that are unique.
-	for _, u := range thumbsUp {
-		if ok := arrayCheck(u, thumbsDown); !ok {
-			tU = append(tU, u)
-		}
+	msg, err := s.ChannelMessage(channelID, msgID)
+	if err != nil {
+		return errors.New("couldn't find our message :frowning: ")
 	}
 
-	for _, u := range thumbsDown {
-		if ok := arrayCheck(u, thumbsUp); !ok {
-			tD = append(tD, u)
-		}
+	poll := pollFromMessage(msg)
+	results, err := poll.TallyReactions(s)
+	if err != nil {
+		return err
 	}
 
 	var toSend = "```"
-	if len(tU) > 0 {
-		for _, u := range tU {
-			toSend += "👍 " + u + "\n"
+	for n, r := range results {
+		if n > 0 {
+			toSend += "\n"
 		}
-	} else {
-		toSend += "👍 none\n"
-	}
-
-	toSend += "\n"
-	if len(tD) > 0 {
-		for _, u := range tD {
-			toSend += "👎 " + u + "\n"
+		if len(r.Voters) == 0 {
+			toSend += r.Emoji + " none\n"
+		}
+		for _, u := range r.Voters {
+			toSend += r.Emoji + " " + u + "\n"
 		}
-	} else {
-		toSend += "👎 none"
 	}
 	toSend += "```"
 
@@ -151,64 +321,756 @@ func (dat *IOdata) voteGet(msgID string) error {
 }
 
 // voteCreate setups the channel and the poll's message.
-func (dat *IOdata) voteCreate(title, description string) error {
+func (dat *IOdata) voteCreate(poll *Poll) error {
 	s := dat.session
-	// Get our channels from the server.
-	channels, err := s.GuildChannels(dat.guild.ID)
+
+	if poll.ChannelID == "" {
+		ch, err := dat.voteChannel(true)
+		if err != nil {
+			return err
+		}
+		poll.ChannelID = ch.ID
+	}
+
+	var err error
+	if poll.PollID, err = pollNextID(); err != nil {
+		return err
+	}
+
+	if err = poll.Post(s); err != nil {
+		return err
+	}
+
+	if err = poll.Update(); err != nil {
+		return err
+	}
+
+	if !poll.Closes.IsZero() {
+		poll.Schedule(s)
+	}
+
+	// Respond to the channel it was created in that the poll now exists.
+	dat.output = fmt.Sprintf("Poll #%d created! Check out <#%s> to participate.", poll.PollID, poll.ChannelID)
+
+	return nil
+}
+
+// Emojis returns the reactions used to vote, in the order of the options.
+func (poll *Poll) Emojis() []string {
+	if len(poll.Options) == 0 {
+		return []string{voteEmojiYes, voteEmojiNo}
+	}
+	return voteEmojiNumbers[:len(poll.Options)]
+}
+
+// Labels returns the text for each option.
+func (poll *Poll) Labels() []string {
+	if len(poll.Options) == 0 {
+		return []string{"Yes", "No"}
+	}
+	return poll.Options
+}
+
+// Post sends the poll to its channel and adds the reactions to vote with.
+func (poll *Poll) Post(s *discordgo.Session) error {
+	var desc string
+	if poll.Description != "" {
+		desc = poll.Description + "\n\n"
+	}
+	labels := poll.Labels()
+	for n, e := range poll.Emojis() {
+		desc += e + "  " + labels[n] + "\n"
+	}
+	if poll.Ranked {
+		desc += fmt.Sprintf("\nRank the options by sending me a direct message of `%svote %d [first] [second] ...`",
+			ConfigFile.Prefix, poll.PollID)
+	} else if poll.Anonymous {
+		desc += fmt.Sprintf("\nThis poll is anonymous. Send me a direct message of `%svote %d [number]` to vote.",
+			ConfigFile.Prefix, poll.PollID)
+	}
+	switch poll.Weight {
+	case voteWeightRole:
+		desc += "\nVotes are weighted by role."
+	case voteWeightCredits:
+		desc += "\nVotes are weighted by credits."
+	}
+
+	embed := embedCreator(desc, ColorBlue)
+	embed.Title = "[POLL]  " + poll.Title
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Poll #%d", poll.PollID)}
+	if !poll.Closes.IsZero() {
+		embed.Footer.Text += "  -  Closes: " + poll.Closes.Format(time.UnixDate)
+	}
+
+	msg, err := s.ChannelMessageSendEmbed(poll.ChannelID, embed)
 	if err != nil {
 		return err
 	}
+	poll.MessageID = msg.ID
 
-	// Check if the channel exists already.
-	var ch *discordgo.Channel
-	for _, c := range channels {
-		if c.Name == "vote" {
-			ch = c
+	// Polls voted on by DM don't use reactions.
+	if poll.ByDM() {
+		return nil
+	}
+
+	// Add our reactions in order, remove the poll if any fail.
+	for _, e := range poll.Emojis() {
+		if err = s.MessageReactionAdd(poll.ChannelID, msg.ID, e); err != nil {
+			if err1 := s.ChannelMessageDelete(poll.ChannelID, msg.ID); err1 != nil {
+				return err
+			}
+			return errors.New("Error creating poll, try again")
+		}
+	}
+
+	return nil
+}
+
+// Schedule closes the poll and posts the results once it expires.
+func (poll *Poll) Schedule(s *discordgo.Session) {
+	var p = &Poll{ServerID: poll.ServerID, PollID: poll.PollID}
+	time.AfterFunc(time.Until(poll.Closes), func() {
+		if err := p.Close(s); err != nil {
+			fmt.Println("Closing poll: " + err.Error())
+		}
+	})
+}
+
+// ByDM is true if the poll is voted on by direct message instead of reactions.
+func (poll *Poll) ByDM() bool {
+	return poll.Anonymous || poll.Ranked
+}
+
+// Tally counts the ballots of the poll by their first choice.
+func (poll *Poll) Tally() []PollResult {
+	return poll.count(make([]bool, len(poll.Labels())))
+}
+
+// count gives each ballot to its most preferred option that isn't eliminated.
+func (poll *Poll) count(eliminated []bool) []PollResult {
+	var results []PollResult
+	labels := poll.Labels()
+	for n, e := range poll.Emojis() {
+		results = append(results, PollResult{Emoji: e, Option: labels[n]})
+	}
+
+	for _, b := range poll.Ballots {
+		for _, c := range b.Choices {
+			if c < 0 || c >= len(results) || eliminated[c] {
+				continue
+			}
+			r := &results[c]
+			r.Voters = append(r.Voters, b.User.String())
+			r.Votes += poll.weightOf(b)
 			break
 		}
 	}
+	return results
+}
 
-	// Channel doesn't exists. Create it.
-	if ch == nil {
-		if ch, err = s.GuildChannelCreate(dat.guild.ID, "vote", "text"); err != nil {
-			return errors.New("Error creating poll, try again")
+// weightOf gets the votes a ballot is worth.
+func (poll *Poll) weightOf(b Ballot) int {
+	if poll.Weight == "" {
+		return 1
+	}
+	return b.Weight
+}
+
+// Runoff counts ranked ballots by instant runoff. Each round the options with the
+// fewest votes are eliminated and their ballots go to the next choice, until an
+// option has a majority. Returns the final round and an explanation of each round.
+func (poll *Poll) Runoff() ([]PollResult, []string) {
+	var rounds []string
+	labels := poll.Labels()
+	eliminated := make([]bool, len(labels))
+
+	for round := 1; ; round++ {
+		results := poll.count(eliminated)
+
+		var total, remaining int
+		var best, low = -1, -1
+		var standings []string
+		for n, r := range results {
+			if eliminated[n] {
+				continue
+			}
+			total += r.Votes
+			remaining++
+			standings = append(standings, fmt.Sprintf("%s %d", r.Option, r.Votes))
+			if best < 0 || r.Votes > results[best].Votes {
+				best = n
+			}
+			if low < 0 || r.Votes < results[low].Votes {
+				low = n
+			}
 		}
-		// Set the permissions to disable adding messages and additional emojis
-		if err := s.ChannelPermissionSet(ch.ID, dat.guild.ID, "role", 0, 0x00000840); err != nil {
-			return errors.New("Error creating poll, try again")
+
+		line := fmt.Sprintf("**Round %d:** %s.", round, strings.Join(standings, ", "))
+		if total == 0 {
+			return results, append(rounds, line+" No votes.")
+		} else if results[best].Votes*2 > total {
+			line += fmt.Sprintf(" **%s** wins with %d of %d votes.", results[best].Option, results[best].Votes, total)
+			return results, append(rounds, line)
 		}
+
+		// Eliminate every option tied for the fewest votes, unless that is all of them.
+		var out []string
+		for n, r := range results {
+			if !eliminated[n] && r.Votes == results[low].Votes {
+				out = append(out, r.Option)
+			}
+		}
+		if len(out) == remaining {
+			return results, append(rounds, line+" Tie between: "+strings.Join(out, ", ")+".")
+		}
+
+		for n, r := range results {
+			if !eliminated[n] && r.Votes == results[low].Votes {
+				eliminated[n] = true
+			}
+		}
+		rounds = append(rounds, line+" Eliminated: "+strings.Join(out, ", ")+".")
 	}
+}
 
-	// Create the polls message based on the title and description.
-	var msgTxt = "[POLL]  **" + title + "**"
-	if description != "" {
-		msgTxt += fmt.Sprintf("\n```%s```", description)
+// Weigh gets the votes a user's ballot is worth in the poll.
+func (poll *Poll) Weigh(userID string) (int, error) {
+	if poll.Weight != voteWeightRole && poll.Weight != voteWeightCredits {
+		return 1, nil
 	}
 
-	var msg *discordgo.Message
-	if msg, err = s.ChannelMessageSend(ch.ID, msgTxt); err != nil {
-		return err
+	var u = &User{ID: userID}
+	if err := u.Get(userID); err != nil && err != mgo.ErrNotFound {
+		return 0, err
+	}
+
+	if poll.Weight == voteWeightCredits {
+		return u.Credits, nil
+	}
+
+	var g = &GuildConfig{ID: poll.ServerID}
+	if err := g.Get(); err != nil {
+		return 0, err
+	}
+
+	if u.HasRoleType(g, rolePermissionAdmin) {
+		return voteWeightAdmin, nil
+	} else if u.HasRoleType(g, rolePermissionMod) {
+		return voteWeightMod, nil
+	} else if u.HasRoleType(g, rolePermissionBan) {
+		// Restricted users don't get a say.
+		return 0, nil
+	}
+	return 1, nil
+}
+
+// TallyReactions counts the votes from the reactions of the poll. Users that voted
+// for more than one option are not counted. Only the first 100 reactions of each
+// option can be read.
+func (poll *Poll) TallyReactions(s *discordgo.Session) ([]PollResult, error) {
+	var reactions [][]*discordgo.User
+	var votes = make(map[string]int)
+
+	for _, e := range poll.Emojis() {
+		users, err := s.MessageReactions(poll.ChannelID, poll.MessageID, e, 100)
+		if err != nil {
+			return nil, errors.New("couldn't find our message :frowning: ")
+		}
+		for _, u := range users {
+			votes[u.ID]++
+		}
+		reactions = append(reactions, users)
+	}
+
+	var results []PollResult
+	labels := poll.Labels()
+	for n, e := range poll.Emojis() {
+		var r = PollResult{Emoji: e, Option: labels[n]}
+		for _, u := range reactions[n] {
+			if u.Bot || votes[u.ID] > 1 {
+				continue
+			}
+			r.Voters = append(r.Voters, u.String())
+		}
+		r.Votes = len(r.Voters)
+		results = append(results, r)
 	}
 
-	// Add our reactions (thumbsup and thumbsdown)
-	// Thumbs up: U+1F44D / 128077
-	if err = s.MessageReactionAdd(ch.ID, msg.ID, emojiIntToStr(128077)); err != nil {
-		if err1 := s.ChannelMessageDelete(ch.ID, msg.ID); err1 != nil {
+	return results, nil
+}
+
+// Sync adds ballots for reactions that were made while the bot couldn't record them.
+func (poll *Poll) Sync(s *discordgo.Session) error {
+	var voted = make(map[string]bool)
+	for _, b := range poll.Ballots {
+		voted[b.User.ID] = true
+	}
+
+	var picks = make(map[string][]int)
+	var users = make(map[string]*discordgo.User)
+	for n, e := range poll.Emojis() {
+		reacted, err := s.MessageReactions(poll.ChannelID, poll.MessageID, e, 100)
+		if err != nil {
 			return err
 		}
-		return errors.New("Error creating poll, try again")
+		for _, u := range reacted {
+			if u.Bot || voted[u.ID] {
+				continue
+			}
+			picks[u.ID] = append(picks[u.ID], n)
+			users[u.ID] = u
+		}
 	}
 
-	// Thumps down: U+1F44E / 128078
-	if err = s.MessageReactionAdd(ch.ID, msg.ID, emojiIntToStr(128078)); err != nil {
-		if err1 := s.ChannelMessageDelete(ch.ID, msg.ID); err1 != nil {
+	tn := time.Now()
+	for id, p := range picks {
+		// Picking several options with reactions doesn't count.
+		if len(p) != 1 {
+			continue
+		}
+		weight, err := poll.Weigh(id)
+		if err != nil {
 			return err
 		}
-		return errors.New("Error creating poll, try again")
+
+		// Only added if the user still has no ballot, they may have just voted.
+		ballot := Ballot{User: UserNew(users[id]).Basic(), Choices: p, Weight: weight, Date: tn}
+		q := bson.M{"pollid": poll.PollID, "ballots.user.id": bson.M{"$ne": id}}
+		c := bson.M{"$push": bson.M{"ballots": ballot}}
+		dbdat := DBdataCreate(Database, CollectionPolls, poll, q, c)
+		if err := dbdat.dbEdit(Poll{}); err == mgo.ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		poll.Ballots = append(poll.Ballots, ballot)
 	}
+	return nil
+}
 
-	// Respond to the channel it was created in that the poll now exists.
-	dat.output = "Poll created! Check out <#" + ch.ID + "> to participate."
+// Close tallies the poll and posts the results to the poll's channel.
+func (poll *Poll) Close(s *discordgo.Session) error {
+	// Reload, ballots may have been cast since the poll was loaded.
+	if err := poll.Get(poll.PollID); err != nil {
+		return err
+	} else if poll.Closed {
+		return nil
+	}
+
+	// Reactions on polls voted by DM aren't votes.
+	if !poll.ByDM() {
+		if err := poll.Sync(s); err != nil {
+			fmt.Println("Syncing poll reactions: " + err.Error())
+		}
+	}
+
+	// Only closed is set, so ballots saved meanwhile aren't overwritten.
+	q := bson.M{"pollid": poll.PollID, "closed": false}
+	c := bson.M{"$set": bson.M{"closed": true}}
+	dbdat := DBdataCreate(Database, CollectionPolls, poll, q, c)
+	if err := dbdat.dbEdit(Poll{}); err == mgo.ErrNotFound {
+		// Closed elsewhere, which posted the results.
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// Reload for the results, with every ballot saved before it closed.
+	if err := poll.Get(poll.PollID); err != nil {
+		return err
+	}
+
+	_, err := s.ChannelMessageSendEmbed(poll.ChannelID, poll.ResultsEmbed())
+	return err
+}
+
+// ResultsEmbed creates an embed of the poll's current results.
+func (poll *Poll) ResultsEmbed() *discordgo.MessageEmbed {
+	var desc string
+	if poll.Ranked {
+		results, rounds := poll.Runoff()
+		desc = pollChart(results) + "\n\n" + strings.Join(rounds, "\n")
+	} else {
+		desc = pollChart(poll.Tally())
+	}
+	if poll.Weight != "" {
+		desc += "\nVotes are weighted by " + poll.Weight + "."
+	}
+
+	embed := embedCreator(desc, ColorBlue)
+	embed.Title = "[CURRENT]  " + poll.Title
+	if poll.Closed {
+		embed.Color = ColorGreen
+		embed.Title = "[RESULTS]  " + poll.Title
+	}
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Poll #%d", poll.PollID)}
+	return embed
+}
+
+// Choice converts an emoji to the index of the option it votes for, -1 if it isn't one.
+func (poll *Poll) Choice(emoji string) int {
+	for n, e := range poll.Emojis() {
+		if e == emoji {
+			return n
+		}
+	}
+	return -1
+}
+
+// Ballot gets the ballot cast by a user, nil if they haven't voted.
+func (poll *Poll) Ballot(userID string) *Ballot {
+	for n, b := range poll.Ballots {
+		if b.User.ID == userID {
+			return &poll.Ballots[n]
+		}
+	}
+	return nil
+}
+
+// pollChart draws the results of a poll as a bar chart.
+func pollChart(results []PollResult) string {
+	var total, width int
+	for _, r := range results {
+		total += r.Votes
+		if len(r.Option) > width {
+			width = len(r.Option)
+		}
+	}
+
+	var chart = "```\n"
+	for _, r := range results {
+		var bar, pct int
+		if total > 0 {
+			bar = r.Votes * voteBarWidth / total
+			pct = r.Votes * 100 / total
+		}
+		chart += fmt.Sprintf("%s %-*s %s%s %d (%d%%)\n", r.Emoji, width, r.Option,
+			strings.Repeat("█", bar), strings.Repeat("░", voteBarWidth-bar), r.Votes, pct)
+	}
+	chart += "```"
+	return fmt.Sprintf("%s**%d** votes counted.", chart, total)
+}
+
+// pollFromMessage rebuilds a poll from a message posted by Post. Older polls
+// without an embed are Yes/No polls.
+func pollFromMessage(msg *discordgo.Message) *Poll {
+	poll := &Poll{ChannelID: msg.ChannelID, MessageID: msg.ID}
+	if len(msg.Embeds) == 0 {
+		return poll
+	}
+
+	embed := msg.Embeds[0]
+	poll.Title = strings.TrimPrefix(embed.Title, "[POLL]  ")
+	for _, ln := range strings.Split(embed.Description, "\n") {
+		for n, e := range voteEmojiNumbers {
+			if strings.HasPrefix(ln, e+"  ") && n == len(poll.Options) {
+				poll.Options = append(poll.Options, strings.TrimPrefix(ln, e+"  "))
+				break
+			}
+		}
+	}
+	return poll
+}
+
+// pollReaction records the vote made by adding or removing a reaction on a poll.
+func pollReaction(s *discordgo.Session, r *discordgo.MessageReaction, added bool) error {
+	var poll = &Poll{}
+	if err := poll.GetByMessage(r.MessageID); err != nil {
+		if err == ErrPollNotFound {
+			return nil
+		}
+		return err
+	} else if poll.Closed {
+		return nil
+	}
+
+	// Reactions would reveal anonymous votes, and can't rank options.
+	if poll.ByDM() {
+		if added {
+			return s.MessageReactionRemove(r.ChannelID, r.MessageID, r.Emoji.APIName(), r.UserID)
+		}
+		return nil
+	}
+
+	choice := poll.Choice(r.Emoji.Name)
+	if choice < 0 {
+		return nil
+	}
+
+	previous := poll.Ballot(r.UserID)
+	if !added {
+		// Only remove the ballot if it was for the reaction removed.
+		if previous != nil && len(previous.Choices) == 1 && previous.Choices[0] == choice {
+			if err := poll.Unvote(r.UserID); err != ErrPollClosed {
+				return err
+			}
+		}
+		return nil
+	}
+
+	u, err := s.User(r.UserID)
+	if err != nil {
+		return err
+	}
+	if err := poll.Vote(UserNew(u).Basic(), []int{choice}); err == ErrPollClosed {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// Remove the reaction of the option they previously voted for.
+	if previous != nil && len(previous.Choices) == 1 && previous.Choices[0] != choice {
+		return s.MessageReactionRemove(r.ChannelID, r.MessageID, poll.Emojis()[previous.Choices[0]], r.UserID)
+	}
+	return nil
+}
+
+// voteDM records a vote for an anonymous or ranked poll sent by direct message.
+func (cfg *Config) voteDM(u *discordgo.User, io []string) (string, error) {
+	usage := fmt.Sprintf("to vote, send: `%svote [poll number] [option number]`", ConfigFile.Prefix)
+	if len(io) < 3 {
+		return "", errors.New(usage)
+	}
 
+	pollID, err := strconv.Atoi(io[1])
+	if err != nil {
+		return "", errors.New(usage)
+	}
+
+	var poll = &Poll{}
+	if err := poll.Get(pollID); err != nil {
+		return "", err
+	} else if poll.Closed {
+		return "", ErrPollClosed
+	} else if !poll.ByDM() {
+		return "", errors.New("that poll is voted on with reactions on the poll itself")
+	} else if !poll.Ranked && len(io) > 3 {
+		return "", errors.New("that poll only takes one option, it isn't ranked")
+	}
+
+	// Options are numbered from 1, ranked ballots list them most preferred first.
+	var choices, picked []int
+	var seen = make(map[int]bool)
+	for _, str := range io[2:] {
+		choice, err := strconv.Atoi(str)
+		if err != nil {
+			return "", errors.New(usage)
+		} else if choice < 1 || choice > len(poll.Labels()) {
+			return "", fmt.Errorf("pick options from 1 to %d", len(poll.Labels()))
+		} else if seen[choice] {
+			return "", errors.New("each option can only be ranked once")
+		}
+		seen[choice] = true
+		choices = append(choices, choice-1)
+		picked = append(picked, choice)
+	}
+
+	// Only members of the guild the poll is in can vote.
+	if _, err := cfg.Core.Session.GuildMember(poll.ServerID, u.ID); err != nil {
+		return "", ErrPollNotFound
+	}
+
+	if err := poll.Vote(UserNew(u).Basic(), choices); err != nil {
+		return "", err
+	}
+
+	var labels []string
+	for _, c := range picked {
+		labels = append(labels, poll.Labels()[c-1])
+	}
+	return fmt.Sprintf("Your vote for **%s** in poll #%d (**%s**) was recorded. Vote again to change it.",
+		strings.Join(labels, "**, then **"), poll.PollID, poll.Title), nil
+}
+
+// PollsLoad schedules the open polls that close on their own.
+func (cfg *Config) PollsLoad() error {
+	var q = make(map[string]interface{})
+	q["closed"] = false
+
+	dbdat := DBdataCreate(Database, CollectionPolls, Poll{}, q, nil)
+	if err := dbdat.dbGetWithLimit(Poll{}, []string{"pollid"}, 0); err != nil {
+		return err
+	}
+
+	for _, d := range dbdat.Documents {
+		poll := d.(Poll)
+		if !poll.Closes.IsZero() {
+			poll.Schedule(cfg.Core.Session)
+		}
+	}
+	return nil
+}
+
+// pollNextID gets the number for a new poll from a counter, so polls created
+// at once get different numbers and numbers aren't reused once deleted.
+func pollNextID() (int, error) {
+	if err := pollCounterInit(); err != nil {
+		return -1, err
+	}
+
+	var q = bson.M{"name": CollectionPolls}
+	counter := DBdataCreate(Database, CollectionCounters, nil, q, nil)
+	return counter.dbIncrement("seq")
+}
+
+// pollCounterInit moves the poll counter past the numbers already used, such as
+// by polls made before it existed. It never moves it back.
+func pollCounterInit() error {
+	dbdat := DBdataCreate(Database, CollectionPolls, Poll{}, nil, nil)
+	if err := dbdat.dbGetWithLimit(Poll{}, []string{"-pollid"}, 1); err != nil {
+		return err
+	} else if len(dbdat.Documents) == 0 {
+		return nil
+	}
+
+	var q = bson.M{"name": CollectionPolls}
+	var c = bson.M{"$max": bson.M{"seq": dbdat.Documents[0].(Poll).PollID}}
+	counter := DBdataCreate(Database, CollectionCounters, nil, q, c)
+	return counter.dbUpsert()
+}
+
+// pollList prints the open polls of a guild.
+func pollList(serverID string) (string, error) {
+	var q = make(map[string]interface{})
+	q["serverid"] = serverID
+	q["closed"] = false
+
+	dbdat := DBdataCreate(Database, CollectionPolls, Poll{}, q, nil)
+	if err := dbdat.dbGetWithLimit(Poll{}, []string{"pollid"}, 0); err != nil {
+		return "", err
+	}
+
+	if len(dbdat.Documents) == 0 {
+		return "There are no open polls.", nil
+	}
+
+	var msg = "```Open polls:\n\nFormat: [Number]  [Votes]  [Title]\n"
+	for _, d := range dbdat.Documents {
+		poll := d.(Poll)
+		var closes string
+		if !poll.Closes.IsZero() {
+			closes = "  (closes " + poll.Closes.Format(time.UnixDate) + ")"
+		}
+		msg += fmt.Sprintf("  #%d [%d] %s%s\n", poll.PollID, len(poll.Ballots), poll.Title, closes)
+	}
+	msg += "```"
+	return msg, nil
+}
+
+// Get a poll from the database, limited to the poll's server if it is set.
+func (poll *Poll) Get(pollID int) error {
+	var q = make(map[string]interface{})
+	q["pollid"] = pollID
+	if poll.ServerID != "" {
+		q["serverid"] = poll.ServerID
+	}
+	return poll.get(q)
+}
+
+// GetByMessage gets the poll that was posted as a message.
+func (poll *Poll) GetByMessage(msgID string) error {
+	var q = make(map[string]interface{})
+	q["messageid"] = msgID
+	return poll.get(q)
+}
+
+func (poll *Poll) get(q bson.M) error {
+	dbdat := DBdataCreate(Database, CollectionPolls, Poll{}, q, nil)
+	if err := dbdat.dbGet(Poll{}); err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrPollNotFound
+		}
+		return err
+	}
+
+	*poll = dbdat.Document.(Poll)
+	return nil
+}
+
+// Update a poll in the database.
+func (poll *Poll) Update() error {
+	var q = make(map[string]interface{})
+	var c = make(map[string]interface{})
+
+	q["pollid"] = poll.PollID
+	c["$set"] = bson.M{
+		"serverid":    poll.ServerID,
+		"title":       poll.Title,
+		"description": poll.Description,
+		"options":     poll.Options,
+		"channelid":   poll.ChannelID,
+		"messageid":   poll.MessageID,
+		"creator":     poll.Creator,
+		"created":     poll.Created,
+		"closes":      poll.Closes,
+		"closed":      poll.Closed,
+		"anonymous":   poll.Anonymous,
+		"ranked":      poll.Ranked,
+		"weight":      poll.Weight,
+		"ballots":     poll.Ballots,
+	}
+
+	dbdat := DBdataCreate(Database, CollectionPolls, poll, q, c)
+	if err := dbdat.dbEdit(Poll{}); err != nil {
+		if err == mgo.ErrNotFound {
+			// Add to DB since it doesn't exist.
+			return dbdat.dbInsert()
+		}
+		return err
+	}
+	return nil
+}
+
+// Vote replaces any previous ballot of the user with a new one.
+func (poll *Poll) Vote(user UserBasic, choices []int) error {
+	weight, err := poll.Weigh(user.ID)
+	if err != nil {
+		return err
+	}
+
+	var ballot = Ballot{User: user, Choices: choices, Weight: weight, Date: time.Now()}
+	for n := 0; n < pollVoteTries; n++ {
+		if err := poll.Unvote(user.ID); err != nil {
+			return err
+		}
+
+		// Only added while the poll is open and the user has no ballot, another
+		// vote of theirs may have been saved since theirs was removed.
+		q := bson.M{"pollid": poll.PollID, "closed": false, "ballots.user.id": bson.M{"$ne": user.ID}}
+		c := bson.M{"$push": bson.M{"ballots": ballot}}
+		dbdat := DBdataCreate(Database, CollectionPolls, poll, q, c)
+		if err := dbdat.dbEdit(Poll{}); err == mgo.ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		poll.Ballots = append(poll.Ballots, ballot)
+		return nil
+	}
+	return errors.New("your vote couldn't be recorded, try again")
+}
+
+// Unvote removes the ballot of a user, unless the poll has closed.
+func (poll *Poll) Unvote(userID string) error {
+	var q = make(map[string]interface{})
+	var c = make(map[string]interface{})
+	q["pollid"] = poll.PollID
+	q["closed"] = false
+	c["$pull"] = bson.M{"ballots": bson.M{"user.id": userID}}
+
+	dbdat := DBdataCreate(Database, CollectionPolls, poll, q, c)
+	if err := dbdat.dbEdit(Poll{}); err == mgo.ErrNotFound {
+		return ErrPollClosed
+	} else if err != nil {
+		return err
+	}
+
+	for n, b := range poll.Ballots {
+		if b.User.ID == userID {
+			poll.Ballots = append(poll.Ballots[:n], poll.Ballots[n+1:]...)
+			break
+		}
+	}
 	return nil
 }
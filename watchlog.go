@@ -0,0 +1,473 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Types of events sent to WatchLogs.
+const (
+	watchHello   = "hello" // Sent to a client once it is accepted.
+	watchError   = "error" // Sent to a client before it is disconnected.
+	watchMessage = "message"
+	watchEdit    = "edit"
+	watchDelete  = "delete"
+	watchJoin    = "join"
+	watchLeave   = "leave"
+	watchClosed  = "closed" // Sent to a client when the watcher is stopped.
+)
+
+// watchEvents are the event types a client can filter on.
+var watchEvents = []string{watchMessage, watchEdit, watchDelete, watchJoin, watchLeave}
+
+// watchHandshake is how long a client has to authenticate.
+const watchHandshake = 10 * time.Second
+
+// WatchEvent is a single line of the WatchLog protocol.
+type WatchEvent struct {
+	Type          string    `json:"type"`
+	Time          time.Time `json:"time"`
+	GuildID       string    `json:"guild_id,omitempty"`
+	GuildName     string    `json:"guild_name,omitempty"`
+	ChannelID     string    `json:"channel_id,omitempty"`
+	ChannelName   string    `json:"channel_name,omitempty"`
+	MessageID     string    `json:"message_id,omitempty"`
+	UserID        string    `json:"user_id,omitempty"`
+	Username      string    `json:"username,omitempty"`
+	Discriminator string    `json:"discriminator,omitempty"`
+	Content       string    `json:"content,omitempty"`
+	Previous      []string  `json:"previous,omitempty"`    // Earlier content of an edited message.
+	Attachments   []string  `json:"attachments,omitempty"` // URLs of attached files.
+	Archived      bool      `json:"archived,omitempty"`    // Pulled from the database when attaching.
+}
+
+// WatchHello is the first line a client sends. It authenticates the client and
+// chooses which events it receives.
+type WatchHello struct {
+	Token  string   `json:"token"`
+	Users  []string `json:"users,omitempty"`  // User IDs or names, empty for everyone.
+	Match  string   `json:"match,omitempty"`  // Regular expression the content must match.
+	Events []string `json:"events,omitempty"` // Event types, empty for all.
+}
+
+// watchFilter decides which events a client receives.
+type watchFilter struct {
+	users  []string
+	match  *regexp.Regexp
+	events []string
+}
+
+// watchFilterNew validates the filters requested by a client.
+func watchFilterNew(hello WatchHello) (*watchFilter, error) {
+	var f = &watchFilter{}
+	for _, u := range hello.Users {
+		if u = strings.ToLower(strings.TrimSpace(u)); u != "" {
+			f.users = append(f.users, u)
+		}
+	}
+
+	for _, e := range hello.Events {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if !strContains(watchEvents, e) {
+			return nil, fmt.Errorf("unknown event '%s', events are: %s", e, strings.Join(watchEvents, ", "))
+		}
+		f.events = append(f.events, e)
+	}
+
+	if hello.Match != "" {
+		var err error
+		if f.match, err = regexp.Compile(hello.Match); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Allows checks if an event passes the filters.
+func (f *watchFilter) Allows(ev WatchEvent) bool {
+	if f == nil {
+		return true
+	} else if len(f.events) > 0 && !strContains(f.events, ev.Type) {
+		return false
+	} else if len(f.users) > 0 && !strContains(f.users, ev.UserID) && !strContains(f.users, strings.ToLower(ev.Username)) {
+		return false
+	} else if f.match != nil && !f.match.MatchString(ev.Content) {
+		return false
+	}
+	return true
+}
+
+// String converts an event to readable text.
+func (ev WatchEvent) String() string {
+	var output = "--> "
+	if ev.Archived {
+		output = "<-- "
+	}
+
+	if ev.ChannelName != "" {
+		output += "[" + ev.ChannelName + "]"
+	}
+	user := ev.Username + "#" + ev.Discriminator
+
+	switch ev.Type {
+	case watchJoin:
+		return output + user + " joined " + ev.GuildName
+	case watchLeave:
+		return output + user + " left " + ev.GuildName
+	case watchEdit:
+		output += "(edited)"
+	case watchDelete:
+		output += "(deleted)"
+	case watchMessage:
+	default:
+		return output + ev.Content
+	}
+
+	output += "[" + user + "] " + ev.Content
+	for _, a := range ev.Attachments {
+		output += " " + a
+	}
+	return output
+}
+
+// watchEventNew creates an event for a message from the database.
+func watchEventNew(typ, guildID, guildName string, m *Message) WatchEvent {
+	return WatchEvent{
+		Type:          typ,
+		Time:          m.Timestamp,
+		GuildID:       guildID,
+		GuildName:     guildName,
+		ChannelID:     m.ChannelID,
+		ChannelName:   m.ChannelName,
+		MessageID:     m.ID,
+		UserID:        m.Author.ID,
+		Username:      m.Author.Name,
+		Discriminator: m.Author.Discriminator,
+		Content:       m.Content,
+		Previous:      m.EditedContent,
+	}
+}
+
+// watchEventMessage creates an event for a new message.
+func watchEventMessage(guildID, guildName, channelName string, m *discordgo.Message) WatchEvent {
+	msg := MessageNew(channelName, m)
+	msg.Content = m.ContentWithMentionsReplaced()
+
+	ev := watchEventNew(watchMessage, guildID, guildName, msg)
+	for _, a := range m.Attachments {
+		ev.Attachments = append(ev.Attachments, a.URL)
+	}
+	return ev
+}
+
+// watchEventMember creates an event for a user joining or leaving a guild.
+func (cfg *Config) watchEventMember(typ, guildID string, u *discordgo.User) WatchEvent {
+	ev := WatchEvent{
+		Type:          typ,
+		Time:          time.Now(),
+		GuildID:       guildID,
+		UserID:        u.ID,
+		Username:      u.Username,
+		Discriminator: u.Discriminator,
+	}
+	if g := cfg.Core.GetGuild(guildID); g != nil {
+		ev.GuildName = g.Name
+	}
+	return ev
+}
+
+// watchLogHandler sends an event to the WatchLogs of its guild and channel.
+// Events without a channel, such as joins, go to every WatchLog of the guild.
+func (cfg *Config) watchLogHandler(ev WatchEvent) {
+	for _, w := range cfg.watchList() {
+		if w.guildID != ev.GuildID {
+			continue
+		} else if ev.ChannelID != "" && !w.channelAll && w.channelID != ev.ChannelID {
+			continue
+		}
+		w.Talk(ev)
+	}
+}
+
+// watchTokenGet gets the secret clients authenticate with. Uses the token in
+// the configuration file, or one generated for this run if there isn't one.
+func (cfg *Config) watchTokenGet() (string, error) {
+	if ConfigFile.WatchToken != "" {
+		return ConfigFile.WatchToken, nil
+	}
+
+	cfg.watchedMu.Lock()
+	defer cfg.watchedMu.Unlock()
+	if cfg.watchToken == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("generating a watcher token: %s", err)
+		}
+		cfg.watchToken = hex.EncodeToString(b)
+	}
+	return cfg.watchToken, nil
+}
+
+// watchAuth reads the client's hello and checks its token.
+func (cfg *Config) watchAuth(conn net.Conn) (*watchFilter, error) {
+	conn.SetReadDeadline(time.Now().Add(watchHandshake))
+	defer conn.SetReadDeadline(time.Time{})
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return nil, errors.New("no hello received")
+	}
+
+	var hello WatchHello
+	if err = json.Unmarshal(line, &hello); err != nil {
+		return nil, errors.New("hello is not valid JSON")
+	}
+
+	token, err := cfg.watchTokenGet()
+	if err != nil {
+		return nil, err
+	} else if subtle.ConstantTimeCompare([]byte(hello.Token), []byte(token)) != 1 {
+		return nil, errors.New("bad token")
+	}
+	return watchFilterNew(hello)
+}
+
+// watchServer waits for a client to attach if the watcher is served, then
+// writes the watched events to it until stopped or the client leaves.
+func (cfg *Config) watchServer(watch *WatchLog, amount int) {
+	defer cfg.watchRemove(watch.id)
+
+	// Printed to this terminal as text, served as JSON lines.
+	var filter *watchFilter
+	var write = func(ev WatchEvent) error {
+		_, err := fmt.Fprintln(cfg.consoleOut(), ev.String())
+		return err
+	}
+
+	if watch.ln != nil {
+		// Closing the listener when stopped ends the wait. Clients that fail to
+		// authenticate are turned away and the next one is waited for.
+		var conn net.Conn
+		for conn == nil {
+			c, err := watch.ln.Accept()
+			if err != nil {
+				return
+			}
+
+			if filter, err = cfg.watchAuth(c); err != nil {
+				fmt.Println("WatchLog [" + watch.guildName + "] refused client: " + err.Error())
+				json.NewEncoder(c).Encode(WatchEvent{Type: watchError, Time: time.Now(), Content: err.Error()})
+				c.Close()
+				continue
+			}
+			conn = c
+		}
+		watch.ln.Close()
+		defer conn.Close()
+
+		enc := json.NewEncoder(conn)
+		write = func(ev WatchEvent) error {
+			return enc.Encode(ev)
+		}
+	}
+
+	watch.stream(amount, filter, write)
+}
+
+// stream writes the watched events until stopped or the output fails.
+func (watch *WatchLog) stream(amount int, filter *watchFilter, write func(WatchEvent) error) {
+	// Initiated text sent to client.
+	var init = "Initiated: " + watch.guildName
+	if watch.channelName != "" {
+		init += " on " + watch.channelName
+	}
+	hello := WatchEvent{Type: watchHello, Time: time.Now(), GuildID: watch.guildID, GuildName: watch.guildName,
+		ChannelID: watch.channelID, ChannelName: watch.channelName, Content: init}
+	if err := write(hello); err != nil {
+		return
+	}
+
+	// Send archived messages desired.
+	if err := watch.getLast(amount, filter, write); err != nil {
+		fmt.Println("Processing archived messages: " + err.Error())
+	}
+
+	// Loop until stopped, or the client can't be written to.
+	for {
+		select {
+		case ev := <-watch.channel:
+			if !filter.Allows(ev) {
+				continue
+			}
+			if err := write(ev); err != nil {
+				fmt.Println("WatchLog [" + watch.guildName + "] output closed: " + err.Error())
+				return
+			}
+		case <-watch.quit:
+			write(WatchEvent{Type: watchClosed, Time: time.Now(), GuildID: watch.guildID, Content: "Closed: " + watch.guildName})
+			return
+		}
+	}
+}
+
+// getLast writes X amount of messages from database to the watch output.
+func (watch *WatchLog) getLast(amount int, filter *watchFilter, write func(WatchEvent) error) error {
+	// Prevent attempting bad number of messages.
+	if amount <= 0 {
+		return nil
+	}
+
+	var q = make(map[string]interface{})
+	if watch.channelID != "" {
+		q["channelid"] = watch.channelID
+	} else {
+		q = nil
+	}
+
+	var err error
+	dbdat := DBdataCreate(watch.guildID, CollectionMessages, Message{}, q, nil)
+	if err = dbdat.dbGetWithLimit(Message{}, []string{"-timestamp"}, amount); err != nil {
+		return err
+	}
+
+	var msgs []Message
+	var msg Message
+	for _, m := range dbdat.Documents {
+		msg = m.(Message)
+		msgs = append(msgs, msg)
+	}
+
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+
+	for _, m := range msgs {
+		ev := watchEventNew(watchMessage, watch.guildID, watch.guildName, &m)
+		ev.Archived = true
+		if !filter.Allows(ev) {
+			continue
+		}
+		if err = write(ev); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Talk sends an event over a channel. Events are dropped if the output can't
+// keep up so handlers are never held up by a slow watcher.
+func (watch *WatchLog) Talk(ev WatchEvent) {
+	select {
+	case watch.channel <- ev:
+	case <-watch.quit:
+	default:
+	}
+}
+
+// Stop the watcher, it is removed once its output is closed.
+func (watch *WatchLog) Stop() {
+	watch.stop.Do(func() {
+		close(watch.quit)
+		if watch.ln != nil {
+			watch.ln.Close()
+		}
+	})
+}
+
+// watchAdd adds a watcher to the list, giving it an ID.
+func (cfg *Config) watchAdd(watch *WatchLog) int {
+	cfg.watchedMu.Lock()
+	defer cfg.watchedMu.Unlock()
+	cfg.watchedID++
+	watch.id = cfg.watchedID
+	cfg.watched = append(cfg.watched, watch)
+	return watch.id
+}
+
+// watchRemove removes a watcher from the list.
+func (cfg *Config) watchRemove(id int) {
+	cfg.watchedMu.Lock()
+	defer cfg.watchedMu.Unlock()
+	for n, w := range cfg.watched {
+		if w.id == id {
+			cfg.watched = append(cfg.watched[:n], cfg.watched[n+1:]...)
+			return
+		}
+	}
+}
+
+// watchList copies the list of watchers.
+func (cfg *Config) watchList() []*WatchLog {
+	cfg.watchedMu.Lock()
+	defer cfg.watchedMu.Unlock()
+	return append([]*WatchLog(nil), cfg.watched...)
+}
+
+// clientLaunch attaches to a WatchLog served by the bot and prints the events
+// it receives, as text or as the JSON lines sent.
+func clientLaunch() {
+	var network, address = "tcp", net.JoinHostPort(watcherHost, watcherPort)
+	if watcherSocket != "" {
+		network, address = "unix", watcherSocket
+	}
+
+	fmt.Fprint(os.Stderr, "Connecting to "+address+"... ")
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	defer conn.Close()
+
+	hello := WatchHello{Token: watcherToken, Match: watcherMatch}
+	if watcherUsers != "" {
+		hello.Users = strings.Split(watcherUsers, ",")
+	}
+	if watcherEvents != "" {
+		hello.Events = strings.Split(watcherEvents, ",")
+	}
+	if err = json.NewEncoder(conn).Encode(hello); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Connected!")
+
+	// Print events received until the bot closes the connection.
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var ev WatchEvent
+			if jerr := json.Unmarshal(line, &ev); jerr != nil {
+				fmt.Fprintln(os.Stderr, "Bad event: "+jerr.Error())
+			} else if ev.Type == watchError {
+				fmt.Fprintln(os.Stderr, "Refused: "+ev.Content)
+			} else if watcherJSON {
+				os.Stdout.Write(line)
+			} else {
+				fmt.Println(ev.String())
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			break
+		}
+	}
+	fmt.Fprintln(os.Stderr, "Disconnected.")
+}
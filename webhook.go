@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Constants for the webhooks managed by the bot.
+const (
+	webhookName     = "SchiNET Alliance" // Name of the webhooks managed for alliances.
+	webhookFileMax  = 8 << 20            // Largest upload, in bytes, a webhook accepts.
+	webhookNameSize = 80                 // Longest username a webhook can post with.
+)
+
+// webhookGet finds the managed webhook of a channel, creating it if it doesn't exist.
+func webhookGet(s *discordgo.Session, channelID string) (*discordgo.Webhook, error) {
+	hooks, err := s.ChannelWebhooks(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only webhooks created by the bot have a token it can use.
+	for _, h := range hooks {
+		if h.Name == webhookName && h.Token != "" {
+			return h, nil
+		}
+	}
+
+	return s.WebhookCreate(channelID, webhookName, "")
+}
+
+// webhookSend posts a message through a webhook, uploading the files with it.
+// Waits for Discord to create the message so its ID is known.
+func webhookSend(s *discordgo.Session, id, token string, params *discordgo.WebhookParams, files []*discordgo.File) (*discordgo.Message, error) {
+	payload, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var contentType = "application/json"
+	var body = payload
+	if len(files) > 0 {
+		buf := &bytes.Buffer{}
+		w := multipart.NewWriter(buf)
+
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", `form-data; name="payload_json"`)
+		h.Set("Content-Type", "application/json")
+		p, err := w.CreatePart(h)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = p.Write(payload); err != nil {
+			return nil, err
+		}
+
+		for n, f := range files {
+			h := make(textproto.MIMEHeader)
+			h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file%d"; filename="%s"`, n, strings.Replace(f.Name, `"`, `\"`, -1)))
+			if f.ContentType == "" {
+				f.ContentType = "application/octet-stream"
+			}
+			h.Set("Content-Type", f.ContentType)
+			p, err := w.CreatePart(h)
+			if err != nil {
+				return nil, err
+			}
+			if _, err = io.Copy(p, f.Reader); err != nil {
+				return nil, err
+			}
+		}
+
+		if err = w.Close(); err != nil {
+			return nil, err
+		}
+		contentType = w.FormDataContentType()
+		body = buf.Bytes()
+	}
+
+	resp, err := webhookRequest(s, "POST", discordgo.EndpointWebhookToken(id, token)+"?wait=true", contentType, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg *discordgo.Message
+	if err = json.Unmarshal(resp, &msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// webhookEdit changes the content of a message posted by a webhook, keeping
+// only the attachments listed.
+func webhookEdit(s *discordgo.Session, id, token, msgID, content string, attachments []string) error {
+	var keep = []map[string]string{}
+	for _, a := range attachments {
+		keep = append(keep, map[string]string{"id": a})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"content":     content,
+		"attachments": keep,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = webhookRequest(s, "PATCH", discordgo.EndpointWebhookToken(id, token)+"/messages/"+msgID, "application/json", body)
+	return err
+}
+
+// webhookDelete removes a message posted by a webhook.
+func webhookDelete(s *discordgo.Session, id, token, msgID string) error {
+	_, err := webhookRequest(s, "DELETE", discordgo.EndpointWebhookToken(id, token)+"/messages/"+msgID, "", nil)
+	return err
+}
+
+// webhookRequest sends a request to a webhook. Webhooks are authorized by their
+// token, so the bot's own authorization isn't sent.
+func webhookRequest(s *discordgo.Session, method, url, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("webhook request failed: %s %s", resp.Status, string(data))
+	}
+	return data, nil
+}
+
+// webhookFiles downloads attachments so they can be uploaded again. Returns
+// nil if they are too large to upload.
+func webhookFiles(s *discordgo.Session, attachments []*discordgo.MessageAttachment) ([][]byte, error) {
+	var size int
+	for _, a := range attachments {
+		size += a.Size
+	}
+	if size > webhookFileMax {
+		return nil, nil
+	}
+
+	var files [][]byte
+	var read int
+	for _, a := range attachments {
+		resp, err := s.Client.Get(a.URL)
+		if err != nil {
+			return nil, err
+		} else if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("attachment download failed: %s", resp.Status)
+		}
+
+		// Sizes are only declared, what is read is limited too.
+		data, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(webhookFileMax-read+1)))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if read += len(data); read > webhookFileMax {
+			return nil, nil
+		}
+		files = append(files, data)
+	}
+	return files, nil
+}